@@ -17,6 +17,7 @@ import (
 
 var (
 	addr               = flag.String("addr", "192.168.1.240:8000", "http service address")
+	token              = flag.String("token", "token", "survey token")
 	maxConnections     = flag.Int("max", 1000, "maximum number of connections")
 	rampUpTime         = flag.Duration("ramp", 1*time.Minute, "time to ramp up to max connections")
 	testDuration       = flag.Duration("duration", 5*time.Minute, "total test duration")
@@ -36,7 +37,7 @@ func main() {
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
 
-	u := url.URL{Scheme: "ws", Host: *addr, Path: "/ws"}
+	u := url.URL{Scheme: "ws", Host: *addr, Path: "/ws", RawQuery: url.Values{"token": {*token}}.Encode()}
 	log.Printf("Connecting to %s", u.String())
 
 	var wg sync.WaitGroup
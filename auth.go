@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/labstack/echo/v4"
+)
+
+// role is what a principal may do. Higher roles may do everything lower
+// roles may.
+type role int
+
+const (
+	roleParticipant role = iota
+	rolePresenter
+	roleAdmin
+)
+
+// principal is who makes a request: a participant, the presenter of one
+// session, or an admin who may act on any session.
+type principal struct {
+	role role
+	// session is the session a presenter or admin acts on
+	session *Session
+}
+
+const (
+	principalKey = "principal"
+
+	// Admins pick the survey they act on with this header or query parameter
+	adminSurveyHeader = "x-survey"
+	adminSurveyParam  = "survey"
+)
+
+// adminKey unlocks the admin role from the x-token header. There is no admin
+// unless OPENSURVEY_ADMIN_KEY is set.
+var adminKey = os.Getenv("OPENSURVEY_ADMIN_KEY")
+
+// resolvePrincipal works out who makes the request, so routes can be guarded
+// with requireRole.
+func resolvePrincipal(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Set(principalKey, principalOf(c))
+		return next(c)
+	}
+}
+
+// principalOf resolves the principal from the admin key in the x-token
+// header or the presenter login cookie. Anyone else is a participant until
+// requireRole checks a presenter secret in x-token.
+func principalOf(c echo.Context) principal {
+	header := c.Request().Header.Get("x-token")
+	if adminKey != "" && subtle.ConstantTimeCompare([]byte(header), []byte(adminKey)) == 1 {
+		session, _ := sessions.get(requestedSurvey(c))
+		return principal{role: roleAdmin, session: session}
+	}
+
+	if session, ok := presenterLoginSession(c); ok {
+		return principal{role: rolePresenter, session: session}
+	}
+	return principal{role: roleParticipant}
+}
+
+// requestedSurvey returns the survey an admin or a presenter with a secret in
+// x-token picks with the x-survey header or the survey query parameter.
+func requestedSurvey(c echo.Context) string {
+	if survey := c.Request().Header.Get(adminSurveyHeader); survey != "" {
+		return survey
+	}
+	return c.QueryParam(adminSurveyParam)
+}
+
+// secretPrincipal checks a presenter secret in the x-token header against the
+// survey named in x-survey. Only that survey is checked, as hashed secrets
+// take a while.
+func secretPrincipal(c echo.Context) (principal, bool) {
+	session, ok := sessions.get(requestedSurvey(c))
+	if !ok || !secretMatches(session.config().Secret, c.Request().Header.Get("x-token")) {
+		return principal{}, false
+	}
+	return principal{role: rolePresenter, session: session}, true
+}
+
+func currentPrincipal(c echo.Context) principal {
+	p, _ := c.Get(principalKey).(principal)
+	return p
+}
+
+// requireRole guards a route for principals with at least the given role
+// and a session to act on. Presenter secrets in x-token are only checked
+// here, so other routes never spend time on them.
+func requireRole(minimum role) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p := currentPrincipal(c)
+			if p.role < minimum && c.Request().Header.Get("x-token") != "" {
+				if !allowSecretAttempt(c.RealIP()) {
+					log.Printf("Rate limited presenter secrets from %s", c.RealIP())
+					return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Too many attempts, please wait a minute"})
+				}
+				if secret, ok := secretPrincipal(c); ok {
+					p = secret
+					c.Set(principalKey, p)
+				}
+			}
+			if p.role < minimum {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid secret"})
+			}
+			if p.session == nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown survey"})
+			}
+			return next(c)
+		}
+	}
+}
+
+// controlledSession returns the session of the presenter or admin making a
+// request on a route guarded by requireRole.
+func controlledSession(c echo.Context) *Session {
+	return currentPrincipal(c).session
+}
+
+// isPresenterOf reports whether the request comes from the presenter of
+// session or an admin acting on it.
+func isPresenterOf(c echo.Context, session *Session) bool {
+	p := currentPrincipal(c)
+	return p.role >= rolePresenter && p.session == session
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// setupTestServer gives the test an empty store and session registry, and
+// the server with every route.
+func setupTestServer(t *testing.T) *echo.Echo {
+	t.Helper()
+	s, err := openBoltStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("opening store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	store = s
+	if err := loadSigningKey(); err != nil {
+		t.Fatalf("loading signing key: %v", err)
+	}
+	secretAttempts = &rateLimiter{}
+	sessions = &sessionRegistry{
+		byToken: make(map[string]*Session),
+		retired: make(map[string]*Session),
+	}
+
+	e, err := newServer("")
+	if err != nil {
+		t.Fatalf("setting up server: %v", err)
+	}
+	return e
+}
+
+func addTestSession(t *testing.T, token string, secret string) *Session {
+	t.Helper()
+	cfg := Config{
+		Name:      token,
+		Token:     token,
+		Secret:    secret,
+		Questions: true,
+		Survey: []Slide{
+			{Type: "multiple", Question: "Pick one", Answers: []string{"A", "B"}, AllowOther: true},
+		},
+	}
+	if err := store.SaveConfig(cfg); err != nil {
+		t.Fatalf("saving config: %v", err)
+	}
+	session := newSession(cfg)
+	sessions.add(session)
+	return session
+}
+
+// cookieFrom makes a request and returns the cookie called name it sets.
+func cookieFrom(t *testing.T, e *echo.Echo, req *http.Request, name string) *http.Cookie {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	t.Fatalf("%s %s did not set cookie %s, got status %d", req.Method, req.URL, name, rec.Code)
+	return nil
+}
+
+func TestRequireRoleRoutes(t *testing.T) {
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/nextSlide"},
+		{http.MethodGet, "/previousSlide"},
+		{http.MethodGet, "/gotoSlide/1"},
+		{http.MethodGet, "/restartSurvey"},
+		{http.MethodGet, "/lockVoting"},
+		{http.MethodGet, "/unlockVoting"},
+		{http.MethodGet, "/presenter"},
+		{http.MethodPost, "/presenter/token"},
+		{http.MethodGet, "/presenter/codes"},
+		{http.MethodPost, "/presenter/codes"},
+		{http.MethodGet, "/presenter/export"},
+		{http.MethodPost, "/presenter/questions/unknown"},
+		{http.MethodPost, "/presenter/moderation/unknown"},
+		{http.MethodGet, "/presenter/other/1"},
+	}
+
+	const (
+		invalidSecret = `{"error":"Invalid secret"}`
+		unknownSurvey = `{"error":"Unknown survey"}`
+	)
+
+	// Each case names who makes the request, what requireRole answers and
+	// which survey the request may act on if it gets through
+	cases := []struct {
+		name   string
+		as     func(req *http.Request, env testEnv)
+		reject string
+		actsOn func(env testEnv) *Session
+	}{
+		{
+			name:   "no credentials",
+			as:     func(req *http.Request, env testEnv) {},
+			reject: invalidSecret,
+		},
+		{
+			name: "participant cookie",
+			as: func(req *http.Request, env testEnv) {
+				req.AddCookie(env.participant)
+			},
+			reject: invalidSecret,
+		},
+		{
+			name: "presenter of another survey",
+			as: func(req *http.Request, env testEnv) {
+				req.AddCookie(env.otherPresenter)
+				req.Header.Set(adminSurveyHeader, env.survey.config().Token)
+			},
+			actsOn: func(env testEnv) *Session { return env.other },
+		},
+		{
+			name: "presenter by cookie",
+			as: func(req *http.Request, env testEnv) {
+				req.AddCookie(env.presenter)
+			},
+			actsOn: func(env testEnv) *Session { return env.survey },
+		},
+		{
+			name: "presenter by x-token",
+			as: func(req *http.Request, env testEnv) {
+				req.Header.Set("x-token", env.secret)
+				req.Header.Set(adminSurveyHeader, env.survey.config().Token)
+			},
+			actsOn: func(env testEnv) *Session { return env.survey },
+		},
+		{
+			name: "wrong x-token",
+			as: func(req *http.Request, env testEnv) {
+				req.Header.Set("x-token", "wrong")
+				req.Header.Set(adminSurveyHeader, env.survey.config().Token)
+			},
+			reject: invalidSecret,
+		},
+		{
+			name: "x-token of another survey",
+			as: func(req *http.Request, env testEnv) {
+				req.Header.Set("x-token", env.other.config().Secret)
+				req.Header.Set(adminSurveyHeader, env.survey.config().Token)
+			},
+			reject: invalidSecret,
+		},
+		{
+			name: "x-token without x-survey",
+			as: func(req *http.Request, env testEnv) {
+				req.Header.Set("x-token", env.secret)
+			},
+			reject: invalidSecret,
+		},
+		{
+			name: "admin with x-survey",
+			as: func(req *http.Request, env testEnv) {
+				req.Header.Set("x-token", adminKey)
+				req.Header.Set(adminSurveyHeader, env.survey.config().Token)
+			},
+			actsOn: func(env testEnv) *Session { return env.survey },
+		},
+		{
+			name: "admin without x-survey",
+			as: func(req *http.Request, env testEnv) {
+				req.Header.Set("x-token", adminKey)
+			},
+			reject: unknownSurvey,
+		},
+	}
+
+	oldAdminKey := adminKey
+	adminKey = "admin-key"
+	t.Cleanup(func() { adminKey = oldAdminKey })
+
+	for _, route := range routes {
+		for i, tc := range cases {
+			t.Run(route.method+" "+route.path+"/"+tc.name, func(t *testing.T) {
+				e := setupTestServer(t)
+				env := newTestEnv(t, e, i)
+
+				// Records the principal the request was handled as
+				var handledAs principal
+				e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+					return func(c echo.Context) error {
+						err := next(c)
+						handledAs = currentPrincipal(c)
+						return err
+					}
+				})
+
+				req := httptest.NewRequest(route.method, route.path, nil)
+				tc.as(req, env)
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, req)
+				body := strings.TrimSpace(rec.Body.String())
+
+				if tc.reject != "" {
+					if body != tc.reject {
+						t.Fatalf("got status %d %q, want %s", rec.Code, body, tc.reject)
+					}
+					return
+				}
+				if body == invalidSecret || body == unknownSurvey {
+					t.Fatalf("got rejected with %s", body)
+				}
+				if want := tc.actsOn(env); handledAs.session != want {
+					t.Fatalf("acted on survey %v, want %s", surveyName(handledAs.session), want.config().Name)
+				}
+			})
+		}
+	}
+}
+
+// testEnv is a survey with a presenter and a participant, next to another
+// survey with a presenter of its own.
+type testEnv struct {
+	survey         *Session
+	secret         string
+	presenter      *http.Cookie
+	participant    *http.Cookie
+	other          *Session
+	otherPresenter *http.Cookie
+}
+
+func newTestEnv(t *testing.T, e *echo.Echo, i int) testEnv {
+	t.Helper()
+	env := testEnv{secret: fmt.Sprintf("secret%d", i)}
+	env.survey = addTestSession(t, fmt.Sprintf("survey%d", i), env.secret)
+	env.other = addTestSession(t, fmt.Sprintf("other%d", i), fmt.Sprintf("othersecret%d", i))
+
+	env.presenter = cookieFrom(t, e, loginRequest(env.secret), presenterCookieName)
+	env.otherPresenter = cookieFrom(t, e, loginRequest(env.other.config().Secret), presenterCookieName)
+	env.participant = cookieFrom(t, e, httptest.NewRequest(http.MethodGet, "/survey/"+env.survey.config().Token, nil), userIDCookieName)
+	return env
+}
+
+func loginRequest(secret string) *http.Request {
+	form := url.Values{"tokenSearch": {secret}}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	return req
+}
+
+func surveyName(s *Session) string {
+	if s == nil {
+		return "none"
+	}
+	return s.config().Name
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Condition is one showIf rule of a slide. It holds when the participant
+// gave one of the answers in Is, if any, and none of those in IsNot on an
+// earlier slide, numbered from 1.
+type Condition struct {
+	Slide int      `yaml:"slide"`
+	Is    []string `yaml:"is,omitempty"`
+	IsNot []string `yaml:"isNot,omitempty"`
+}
+
+// matches reports whether the answers of a participant to the slide of the
+// condition satisfy it. A slide that was not answered matches only IsNot.
+func (cond Condition) matches(answers []string) bool {
+	given := func(values []string) bool {
+		for _, value := range values {
+			for _, answer := range answers {
+				if answer == value {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	if len(cond.Is) > 0 && !given(cond.Is) {
+		return false
+	}
+	return !given(cond.IsNot)
+}
+
+// showsTo reports whether slide is shown to userID, which is the case when
+// every showIf condition of the slide holds for the answers of the user.
+func (s *Session) showsTo(slide int, userID string) bool {
+	config := s.config()
+	for _, cond := range config.Survey[slide].ShowIf {
+		if !cond.matches(getUserAnswers(config.Token, cond.Slide-1, userID)) {
+			return false
+		}
+	}
+	return true
+}
+
+func getUserAnswers(token string, slide int, userID string) []string {
+	answers, err := store.Answers(token, slide, userID)
+	if err != nil {
+		log.Printf("Error loading answers: %v", err)
+	}
+	return answers
+}
+
+// options returns the answers a participant can pick on the slide, or nil
+// for slides with free text or no answers at all.
+func (slide Slide) options() []string {
+	switch {
+	case slide.isNumeric():
+		return slide.scaleValues()
+	case slide.Type == "text" || slide.Type == matrixSlideType || slide.Type == leaderboardSlideType:
+		return nil
+	case slide.hasOther():
+		return append(append([]string(nil), slide.Answers...), otherOption)
+	default:
+		return slide.Answers
+	}
+}
+
+// validateCondition checks that a showIf condition of slide refers to the
+// answers of an earlier slide.
+func (c Config) validateCondition(slide int, cond Condition) error {
+	if cond.Slide < 1 || cond.Slide > slide {
+		return fmt.Errorf("showIf refers to slide %d, which is not an earlier slide", cond.Slide)
+	}
+	if len(cond.Is) == 0 && len(cond.IsNot) == 0 {
+		return errors.New("showIf needs answers in is or isNot")
+	}
+
+	options := c.Survey[cond.Slide-1].options()
+	if options == nil {
+		return fmt.Errorf("showIf refers to slide %d, which has no answers to pick", cond.Slide)
+	}
+	known := make(map[string]bool)
+	for _, option := range options {
+		known[option] = true
+	}
+	for _, values := range [][]string{cond.Is, cond.IsNot} {
+		for _, value := range values {
+			if !known[value] {
+				return fmt.Errorf("showIf refers to %q, which is not an answer on slide %d", value, cond.Slide)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import "fmt"
+
+// validate rejects configs that would only fail once the survey is running.
+func (c Config) validate() error {
+	if !validToken(c.Token) {
+		return fmt.Errorf("Token must not contain any of %s", tokenReservedChars)
+	}
+	if err := validateSecret(c.Secret); err != nil {
+		return fmt.Errorf("Secret: %w", err)
+	}
+	if c.Mode != "" && !c.isSelfPaced() {
+		return fmt.Errorf("mode %q is not %q", c.Mode, selfPacedMode)
+	}
+	if c.WhenAllAnswered != "" {
+		if err := validateSlideAction(c.WhenAllAnswered); err != nil {
+			return fmt.Errorf("whenAllAnswered %w", err)
+		}
+	}
+	if c.ResultInterval != 0 && c.ResultInterval < minResultInterval {
+		return fmt.Errorf("resultInterval must be at least %s", minResultInterval)
+	}
+	for i, slide := range c.Survey {
+		if slide.OnTimeout != "" {
+			if err := validateSlideAction(slide.OnTimeout); err != nil {
+				return fmt.Errorf("Slide %d: onTimeout %w", i+1, err)
+			}
+		}
+		if err := slide.validateScale(); err != nil {
+			return fmt.Errorf("Slide %d: %w", i+1, err)
+		}
+		if err := slide.validateOther(); err != nil {
+			return fmt.Errorf("Slide %d: %w", i+1, err)
+		}
+		if err := slide.validateRules(); err != nil {
+			return fmt.Errorf("Slide %d: %w", i+1, err)
+		}
+		if err := slide.validateWords(); err != nil {
+			return fmt.Errorf("Slide %d: %w", i+1, err)
+		}
+		for _, cond := range slide.ShowIf {
+			if err := c.validateCondition(i, cond); err != nil {
+				return fmt.Errorf("Slide %d: %w", i+1, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time allowed to write a message to the peer
+	writeWait = 10 * time.Second
+
+	// Time allowed to read the next pong message from the peer
+	pongWait = 60 * time.Second
+
+	// Send pings to the peer with this period, must be less than pongWait
+	pingPeriod = (pongWait * 9) / 10
+
+	// Maximum size of a message read from the peer
+	maxMessageSize = 1024
+
+	// Messages queued for a client before it is considered too slow and dropped
+	clientQueueSize = 64
+
+	// Connects and disconnects are announced at most this often, so a crowd
+	// joining at once does not flood every client with userCount messages
+	countInterval = 250 * time.Millisecond
+)
+
+// Client is a single WebSocket connection. Only writePump writes to conn, and
+// only the hub closes send.
+type Client struct {
+	hub  *Hub
+	conn *websocket.Conn
+	send chan Message
+	// Presenter sockets are not counted as participants
+	presenter bool
+	// userID is the participant on the other end, if the page has one
+	userID string
+}
+
+// Hub fans messages out to the audience of one session. Every client has its
+// own bounded queue, so a slow phone cannot stall the broadcast to everyone
+// else; clients whose queue is full are disconnected.
+type Hub struct {
+	clients    map[*Client]bool
+	broadcast  chan Message
+	register   chan *Client
+	unregister chan *Client
+	count      int32 // connected participants
+	// participants holds the IDs of the connected participants as a
+	// []string, once for every participant however many pages they have
+	// open. Pages without an ID are listed as "" each.
+	participants atomic.Value
+}
+
+func newHub() *Hub {
+	return &Hub{
+		clients:    make(map[*Client]bool),
+		broadcast:  make(chan Message, 256),
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+	}
+}
+
+// clientCount returns the number of connected participants.
+func (h *Hub) clientCount() int32 {
+	return atomic.LoadInt32(&h.count)
+}
+
+// participantIDs returns the IDs of the connected participants.
+func (h *Hub) participantIDs() []string {
+	ids, _ := h.participants.Load().([]string)
+	return ids
+}
+
+func (h *Hub) run() {
+	ticker := time.NewTicker(countInterval)
+	defer ticker.Stop()
+
+	announced := int32(0)
+	for {
+		select {
+		case client := <-h.register:
+			h.clients[client] = true
+			h.updateCount()
+		case client := <-h.unregister:
+			if _, ok := h.clients[client]; ok {
+				h.remove(client)
+			}
+		case msg := <-h.broadcast:
+			h.fanOut(msg)
+		case <-ticker.C:
+			if count := h.clientCount(); count != announced {
+				announced = count
+				h.fanOut(Message{Type: "userCount", Payload: count})
+			}
+		}
+	}
+}
+
+// fanOut queues msg for every client without blocking.
+func (h *Hub) fanOut(msg Message) {
+	for client := range h.clients {
+		if msg.presenterOnly && !client.presenter {
+			continue
+		}
+		select {
+		case client.send <- msg:
+		default:
+			log.Printf("Dropping slow client %s", client.conn.RemoteAddr())
+			h.remove(client)
+		}
+	}
+}
+
+func (h *Hub) remove(client *Client) {
+	delete(h.clients, client)
+	close(client.send)
+	h.updateCount()
+}
+
+func (h *Hub) updateCount() {
+	count := int32(0)
+	ids := []string{}
+	seen := make(map[string]bool)
+	for client := range h.clients {
+		if client.presenter {
+			continue
+		}
+		count++
+		if client.userID == "" || !seen[client.userID] {
+			seen[client.userID] = true
+			ids = append(ids, client.userID)
+		}
+	}
+	atomic.StoreInt32(&h.count, count)
+	h.participants.Store(ids)
+}
+
+// readPump relays emoji messages from the client to the hub until the
+// connection fails or stops answering pings.
+func (c *Client) readPump() {
+	defer func() {
+		c.hub.unregister <- c
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		var msg Message
+		err := c.conn.ReadJSON(&msg)
+		if err != nil {
+			break
+		}
+		if msg.Type == "emoji" || msg.Type == "emojiPopped" {
+			c.hub.broadcast <- msg
+		}
+	}
+}
+
+// writePump is the only writer on the connection. It sends queued messages
+// and keeps the connection alive with pings.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// The hub closed the channel
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
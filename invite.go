@@ -0,0 +1,263 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/csv"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Most invite codes the presenter can generate at once
+	maxInviteCodes      = 1000
+	maxInviteCodeLength = 64
+)
+
+// InviteStatus is how many invite codes of a survey have been used, shown to
+// the presenter.
+type InviteStatus struct {
+	Used  int `json:"used"`
+	Total int `json:"total"`
+}
+
+// isInviteOnly reports whether participants need an invite code to take
+// part. Listing codes in the config turns it on as well.
+func (c Config) isInviteOnly() bool {
+	return c.InviteOnly || len(c.InviteCodes) > 0
+}
+
+// hasInviteCode reports whether code is one of the invite codes. Every code
+// is compared in constant time, so the time taken gives nothing away.
+func (c Config) hasInviteCode(code string) bool {
+	found := 0
+	for _, known := range c.InviteCodes {
+		found |= subtle.ConstantTimeCompare([]byte(known), []byte(code))
+	}
+	return found == 1
+}
+
+// redeemInvite signs the browser in as the participant of code. Everyone who
+// enters the same code takes part as the same participant, so a code answers
+// every slide once however many browsers it is used in.
+func (s *Session) redeemInvite(c echo.Context, code string) (string, error) {
+	userID, used := s.invites.Load(code)
+	if !used {
+		newID, err := generateUserID()
+		if err != nil {
+			return "", err
+		}
+		if userID, used = s.invites.LoadOrStore(code, newID); !used {
+			s.invitees.Store(newID, code)
+			if err := store.SaveInvite(s.config().Token, code, newID); err != nil {
+				log.Printf("Error saving invite: %v", err)
+			}
+			s.invitesChanged()
+		}
+	}
+	setUserIDCookie(c, userID.(string))
+	return userID.(string), nil
+}
+
+// invitedParticipant returns the participant ID of a request to an invite
+// only survey, as long as it was handed out for a code that is still valid.
+func (s *Session) invitedParticipant(c echo.Context) (string, bool) {
+	userID, ok := participantID(c)
+	if !ok || !s.invited(userID) {
+		return "", false
+	}
+	return userID, true
+}
+
+// invited reports whether userID takes part with an invite code that is
+// still valid.
+func (s *Session) invited(userID string) bool {
+	code, ok := s.invitees.Load(userID)
+	return ok && s.config().hasInviteCode(code.(string))
+}
+
+// requireInvite keeps everyone without a valid invite code out of the
+// participant routes of invite only surveys. Only the survey page takes a
+// code, and the presenter may see everything participants see.
+func requireInvite(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token := c.Param("token")
+		if c.Path() == "/ws" {
+			token = c.QueryParam("token")
+		}
+		if token == "" {
+			return next(c)
+		}
+		session, ok := sessions.get(token)
+		if !ok {
+			session, ok = sessions.byRetiredToken(token)
+		}
+		if !ok || !session.config().isInviteOnly() || isPresenterOf(c, session) {
+			return next(c)
+		}
+		if c.Path() == "/survey/:token" && c.QueryParam("code") != "" {
+			return next(c)
+		}
+		if _, ok := session.invitedParticipant(c); !ok {
+			log.Printf("Rejected request without a valid invite code from %s", c.RealIP())
+			return c.String(http.StatusForbidden, "This survey needs an invite code")
+		}
+		return next(c)
+	}
+}
+
+// invitesChanged marks the invite status as stale. It is broadcast to the
+// presenter on the next tick of publishResults.
+func (s *Session) invitesChanged() {
+	atomic.StoreInt32(&s.invitesPending, 1)
+}
+
+func (s *Session) inviteStatus() InviteStatus {
+	codes := s.config().InviteCodes
+	status := InviteStatus{Total: len(codes)}
+	for _, code := range codes {
+		if _, used := s.invites.Load(code); used {
+			status.Used++
+		}
+	}
+	return status
+}
+
+// restoreInvites reloads which participant every used invite code belongs
+// to from the store.
+func (s *Session) restoreInvites() {
+	invites, err := store.Invites(s.config().Token)
+	if err != nil {
+		log.Printf("Error loading invites: %v", err)
+	}
+	for code, userID := range invites {
+		s.invites.Store(code, userID)
+		s.invitees.Store(userID, code)
+	}
+}
+
+// addInviteCodes adds the codes that are not listed yet to the survey and
+// returns them.
+func (s *Session) addInviteCodes(codes []string) []string {
+	s.mu.Lock()
+	known := make(map[string]bool)
+	for _, code := range s.cfg.InviteCodes {
+		known[code] = true
+	}
+	var added []string
+	for _, code := range codes {
+		if code == "" || known[code] {
+			continue
+		}
+		known[code] = true
+		added = append(added, code)
+	}
+	s.cfg.InviteCodes = append(s.cfg.InviteCodes, added...)
+	cfg := s.cfg
+	s.mu.Unlock()
+
+	if err := store.SaveConfig(cfg); err != nil {
+		log.Printf("Error saving config: %v", err)
+	}
+	s.invitesChanged()
+	return added
+}
+
+// handleAddInviteCodes adds the invite codes in the "codes" form value,
+// separated by white space, or generates "count" new ones. It returns the codes added.
+func handleAddInviteCodes(c echo.Context) error {
+	session := controlledSession(c)
+
+	codes := strings.Fields(c.FormValue("codes"))
+	if len(codes) == 0 {
+		count, err := strconv.Atoi(c.FormValue("count"))
+		if err != nil || count < 1 || count > maxInviteCodes {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Count must be between 1 and " + strconv.Itoa(maxInviteCodes)})
+		}
+		for len(codes) < count {
+			code, err := newToken()
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate invite codes"})
+			}
+			codes = append(codes, code)
+		}
+	}
+	for _, code := range codes {
+		if len(code) > maxInviteCodeLength {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invite code is too long"})
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string][]string{"codes": session.addInviteCodes(codes)})
+}
+
+// handleInviteCodes downloads the invite codes of the survey with their join
+// links, for the presenter to hand out.
+func handleInviteCodes(c echo.Context) error {
+	session := controlledSession(c)
+	config := session.config()
+
+	c.Response().Header().Set("Content-Disposition", "attachment; filename=invite_codes.csv")
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv")
+	c.Response().WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(c.Response())
+	w.Write([]string{"Code", "Link", "Used"})
+	for _, code := range config.InviteCodes {
+		_, used := session.invites.Load(code)
+		link := c.Scheme() + "://" + c.Request().Host + "/survey/" + url.PathEscape(config.Token) + "?code=" + url.QueryEscape(code)
+		w.Write([]string{code, link, strconv.FormatBool(used)})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// writeInviteResponses writes the answers of every invite code to the
+// export. Anonymised exports number the codes in random order instead.
+func writeInviteResponses(w *csv.Writer, session *Session, anonymise bool) {
+	config := session.config()
+
+	names := make(map[string]string)
+	session.invitees.Range(func(userID, code interface{}) bool {
+		names[userID.(string)] = code.(string)
+		return true
+	})
+	userIDs := make([]string, 0, len(names))
+	for userID := range names {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return names[userIDs[i]] < names[userIDs[j]] })
+
+	header := "Code"
+	if anonymise {
+		header = "Respondent"
+		shuffled := make([]string, len(userIDs))
+		for i, n := range rand.Perm(len(userIDs)) {
+			shuffled[n] = userIDs[i]
+			names[userIDs[i]] = "Respondent " + strconv.Itoa(n+1)
+		}
+		userIDs = shuffled
+	}
+
+	w.Write([]string{})
+	w.Write([]string{header, "Slide", "Answer"})
+	for _, userID := range userIDs {
+		for i := range config.Survey {
+			answers, err := store.Answers(config.Token, i, userID)
+			if err != nil {
+				log.Printf("Error loading answers: %v", err)
+				continue
+			}
+			for _, answer := range answers {
+				w.Write([]string{names[userID], strconv.Itoa(i + 1), answer})
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// The presenter login is kept apart from the participant cookie, so a
+	// presenter can take part in their own survey
+	presenterCookieName = "opensurvey_presenter"
+	presenterLoginAge   = 12 * time.Hour
+)
+
+// PresenterLogin is a signed in presenter browser. Logins are kept on the
+// server, so logging out revokes them even if the cookie is kept.
+type PresenterLogin struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// startPresenterLogin signs the browser in as the presenter of session.
+func startPresenterLogin(c echo.Context, session *Session) error {
+	id, err := generateUserID()
+	if err != nil {
+		return err
+	}
+	expires := time.Now().Add(presenterLoginAge)
+	login := PresenterLogin{Token: session.config().Token, Expires: expires}
+	if err := store.SavePresenterLogin(id, login); err != nil {
+		return err
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     presenterCookieName,
+		Value:    signValue(id + ":" + strconv.FormatInt(expires.Unix(), 10)),
+		MaxAge:   int(presenterLoginAge / time.Second),
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   c.Request().TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+		Path:     "/",
+	})
+	return nil
+}
+
+// presenterLoginID returns the ID of the login in the presenter cookie if the
+// cookie is genuine and has not expired.
+func presenterLoginID(c echo.Context) (string, bool) {
+	cookie, err := c.Cookie(presenterCookieName)
+	if err != nil {
+		return "", false
+	}
+	value, ok := verifyValue(cookie.Value)
+	if !ok {
+		return "", false
+	}
+	id, expiry, found := strings.Cut(value, ":")
+	if !found {
+		return "", false
+	}
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return "", false
+	}
+	return id, true
+}
+
+// presenterLoginSession returns the session the presenter cookie is signed
+// in to, as long as the login has not been revoked.
+func presenterLoginSession(c echo.Context) (*Session, bool) {
+	id, ok := presenterLoginID(c)
+	if !ok {
+		return nil, false
+	}
+	login, found, err := store.PresenterLogin(id)
+	if err != nil {
+		log.Printf("Error loading presenter login: %v", err)
+		return nil, false
+	}
+	if !found || time.Now().After(login.Expires) {
+		return nil, false
+	}
+	return sessions.get(login.Token)
+}
+
+// handleLogout signs the presenter out. With "everywhere" set, every login
+// to the survey is revoked, not just this browser.
+func handleLogout(c echo.Context) error {
+	if id, ok := presenterLoginID(c); ok {
+		var err error
+		if session, ok := presenterLoginSession(c); ok && c.FormValue("everywhere") == "true" {
+			err = store.DeletePresenterLogins(session.config().Token)
+		} else {
+			err = store.DeletePresenterLogin(id)
+		}
+		if err != nil {
+			log.Printf("Error revoking presenter login: %v", err)
+			return c.String(http.StatusInternalServerError, "Error logging out")
+		}
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     presenterCookieName,
+		Value:    "",
+		MaxAge:   -1,
+		Expires:  time.Now().Add(-1 * time.Hour),
+		HttpOnly: true,
+		Secure:   c.Request().TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+		Path:     "/",
+	})
+	return c.Redirect(http.StatusSeeOther, "/")
+}
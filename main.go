@@ -12,9 +12,6 @@ import (
 	"net/http"
 	"os"
 	"strconv"
-	"strings"
-	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -28,6 +25,26 @@ type Config struct {
 	Token  string  `yaml:"token"`
 	Secret string  `yaml:"secret"`
 	Survey []Slide `yaml:"survey"`
+	// ResultInterval is how often live results are pushed to clients while
+	// answers are coming in, for example "250ms"
+	ResultInterval time.Duration `yaml:"resultInterval,omitempty"`
+	// WhenAllAnswered is "next" or "lock" to move on or close voting once
+	// every connected participant has answered the active slide
+	WhenAllAnswered string `yaml:"whenAllAnswered,omitempty"`
+	// Questions opens the audience Q&A board next to the slides
+	Questions bool `yaml:"questions,omitempty"`
+	// RateLimit caps the answers per minute from one IP address or one
+	// participant, against scripted voting
+	RateLimit RateLimit `yaml:"rateLimit,omitempty"`
+	// Mode "self-paced" lets every participant move through the slides on
+	// their own, without a presenter. Time limits and leaderboard slides
+	// only apply to live surveys.
+	Mode string `yaml:"mode,omitempty"`
+	// InviteOnly closes the survey to everyone without one of the
+	// InviteCodes, which join with /survey/<token>?code=<code>. The
+	// presenter can add codes while the survey runs.
+	InviteOnly  bool     `yaml:"inviteOnly,omitempty"`
+	InviteCodes []string `yaml:"inviteCodes,omitempty"`
 }
 
 type Slide struct {
@@ -35,61 +52,184 @@ type Slide struct {
 	Question   string   `yaml:"question"`
 	ResultType string   `yaml:"result"`
 	Answers    []string `yaml:"answers,omitempty"`
+	// TimeLimit starts a countdown when the slide becomes active, for
+	// example "30s". OnTimeout is "lock" (default) to close voting or
+	// "next" to move on to the next slide when it runs out.
+	TimeLimit time.Duration `yaml:"timeLimit,omitempty"`
+	OnTimeout string        `yaml:"onTimeout,omitempty"`
+	// Correct turns the slide into a quiz question worth Points (default 1).
+	// Timed slides award up to SpeedBonus extra points for fast answers.
+	Correct    []string `yaml:"correct,omitempty"`
+	Points     int      `yaml:"points,omitempty"`
+	SpeedBonus int      `yaml:"speedBonus,omitempty"`
+	// Range and end labels of "scale" slides. "nps" slides are always 0-10.
+	Min      float64 `yaml:"min,omitempty"`
+	Max      float64 `yaml:"max,omitempty"`
+	Step     float64 `yaml:"step,omitempty"`
+	MinLabel string  `yaml:"minLabel,omitempty"`
+	MaxLabel string  `yaml:"maxLabel,omitempty"`
+	// Top limits "ranking" slides to ranking the best Top answers instead
+	// of all of them
+	Top int `yaml:"top,omitempty"`
+	// Statements of "matrix" slides and the scale every one is rated on
+	Rows    []string `yaml:"rows,omitempty"`
+	Columns []string `yaml:"columns,omitempty"`
+	// Moderation holds the answers of "text" slides until the presenter
+	// approves them
+	Moderation bool `yaml:"moderation,omitempty"`
+	// Answers to "text" slides are normalised before they are counted.
+	// StopWordLists picks built in stop words ("en", "no") and StopWords
+	// adds more. Stem reduces words to their stem in "en" or "no", and
+	// Synonyms merges words or phrases into one entry.
+	StopWordLists []string          `yaml:"stopWordLists,omitempty"`
+	StopWords     []string          `yaml:"stopWords,omitempty"`
+	Stem          string            `yaml:"stem,omitempty"`
+	Synonyms      map[string]string `yaml:"synonyms,omitempty"`
+	// Validation of submissions. Slides must be answered unless Required
+	// is false. MinSelections and MaxSelections limit "multiple" slides,
+	// text answers are checked against MinLength, MaxLength (default 500),
+	// MaxWords and Pattern, a regular expression for the whole answer that
+	// PatternHint explains to participants.
+	Required      *bool  `yaml:"required,omitempty"`
+	MinSelections int    `yaml:"minSelections,omitempty"`
+	MaxSelections int    `yaml:"maxSelections,omitempty"`
+	MinLength     int    `yaml:"minLength,omitempty"`
+	MaxLength     int    `yaml:"maxLength,omitempty"`
+	MaxWords      int    `yaml:"maxWords,omitempty"`
+	Pattern       string `yaml:"pattern,omitempty"`
+	PatternHint   string `yaml:"patternHint,omitempty"`
+	// AllowOther adds an "Other" choice with a free text field to
+	// "multiple" and "radio" slides
+	AllowOther bool `yaml:"allowOther,omitempty"`
+	// ShowIf limits the slide to participants whose earlier answers meet
+	// every condition. Everyone else skips it.
+	ShowIf []Condition `yaml:"showIf,omitempty"`
 }
 
 type Message struct {
 	Type    string      `json:"type"`
 	Payload interface{} `json:"payload"`
+	// presenterOnly messages are not sent to the audience
+	presenterOnly bool
 }
 
 var (
-	config        Config
-	currentSlide  int32 = -1
-	answers       sync.Map
-	clients       sync.Map
-	broadcast     = make(chan Message, 100)
-	upgrader      = websocket.Upgrader{}
-	userResponses sync.Map
-	clientCount   int32 = 0
+	upgrader = websocket.Upgrader{}
+	store    Store
 )
 
 const (
 	userIDCookieName = "opensurvey_cookie"
 	cookieMaxAge     = 2 * 60 * 60 // 2 hours in seconds
+	defaultDBPath    = "opensurvey.db"
 )
 
 func main() {
+	// "opensurvey hash-secret <secret>" prints a hash to put in the config
+	// instead of the presenter secret
+	if len(os.Args) == 3 && os.Args[1] == "hash-secret" {
+		hash, err := hashSecret(os.Args[2])
+		if err != nil {
+			log.Fatalf("Error hashing secret: %v", err)
+		}
+		fmt.Println(hash)
+		return
+	}
+
+	dbPath := os.Getenv("OPENSURVEY_DB")
+	if dbPath == "" {
+		dbPath = defaultDBPath
+	}
+	boltStore, err := openBoltStore(dbPath)
+	if err != nil {
+		log.Fatalf("Error opening store %s: %v", dbPath, err)
+	}
+	defer boltStore.Close()
+	store = boltStore
+	if err := loadSigningKey(); err != nil {
+		log.Fatalf("Error loading signing key: %v", err)
+	}
+
+	restoreState()
 	loadConfig("config.yaml")
 
+	e, err := newServer(os.Getenv("OPENSURVEY_TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("Error in OPENSURVEY_TRUSTED_PROXIES: %v", err)
+	}
+	e.Logger.Fatal(e.Start(":8080"))
+}
+
+// newServer sets up the routes. X-Forwarded-For is only believed from the
+// proxies in trustedProxies.
+func newServer(trustedProxies string) (*echo.Echo, error) {
+	extractor, err := ipExtractor(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
 	e := echo.New()
+	e.IPExtractor = extractor
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	e.HTTPErrorHandler = customErrorHandler
 
 	e.Static("/static", "static")
 
-	t := template.Must(template.ParseGlob("views/*.html"))
+	t := template.Must(template.New("").Funcs(templateFuncs).ParseGlob("views/*.html"))
 	template.Must(t.ParseGlob("views/_layout/*.html"))
 	template.Must(t.ParseGlob("views/components/*.html"))
 	e.Renderer = &TemplateRenderer{templates: t}
 
+	e.Use(resolvePrincipal)
+	e.Use(followRotatedToken)
+	e.Use(requireInvite)
+
+	presenter := requireRole(rolePresenter)
+
 	e.GET("/", handleIndex)
 	e.POST("/", handleToken)
 	e.GET("/survey/:token", handleSurvey)
 	e.POST("/submit/:token", handleSubmit)
+	e.POST("/nickname/:token", handleNickname)
 	e.GET("/results/:token", handleResults)
 	e.GET("/completed/:token", handleCompleted)
+	e.GET("/questions/:token", handleQuestions)
+	e.POST("/questions/:token", handleAskQuestion)
+	e.POST("/questions/:token/:id/upvote", handleUpvoteQuestion)
 	e.GET("/ws", handleWebSocket)
-	e.GET("/nextSlide", handleNextSlide)
-
-	e.GET("/presenter", handlePresenter)
-	e.GET("/presenter/export", handleExport)
+	e.GET("/nextSlide", handleNextSlide, presenter, requireLive)
+	e.GET("/previousSlide", handlePreviousSlide, presenter, requireLive)
+	e.GET("/gotoSlide/:slide", handleGotoSlide, presenter, requireLive)
+	e.GET("/restartSurvey", handleRestartSurvey, presenter)
+	e.GET("/lockVoting", handleLockVoting, presenter, requireLive)
+	e.GET("/unlockVoting", handleUnlockVoting, presenter, requireLive)
+
+	e.GET("/presenter", handlePresenter, presenter)
+	e.POST("/presenter/logout", handleLogout)
+	e.POST("/presenter/token", handleRotateToken, presenter)
+	e.GET("/presenter/codes", handleInviteCodes, presenter)
+	e.POST("/presenter/codes", handleAddInviteCodes, presenter)
+	e.GET("/presenter/export", handleExport, presenter)
+	e.POST("/presenter/questions/:id", handleModerateQuestion, presenter)
+	e.POST("/presenter/moderation/:id", handleModerateAnswer, presenter)
+	e.GET("/presenter/other/:slide", handleOtherTexts, presenter)
 	e.GET("/upload", handleUploadPage)
 	e.POST("/upload", handleUpload)
+	return e, nil
+}
 
-	go handleMessages()
-
-	e.Logger.Fatal(e.Start(":8080"))
+var templateFuncs = template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+	"dec": func(i int) int { return i - 1 },
+	"contains": func(list []string, value string) bool {
+		for _, v := range list {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	},
 }
 
 type TemplateRenderer struct {
@@ -100,19 +240,107 @@ func (t *TemplateRenderer) Render(w io.Writer, name string, data interface{}, c
 	return t.templates.ExecuteTemplate(w, name, data)
 }
 
+// loadConfig starts the survey in filename unless a session with the same
+// token was already restored from the store.
 func loadConfig(filename string) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		log.Printf("Error reading config file: %v", err)
-		config = Config{} // Initialize empty config
 		return
 	}
 
+	var config Config
 	err = yaml.Unmarshal(data, &config)
 	if err != nil {
 		log.Printf("Error parsing config file: %v", err)
-		config = Config{} // Initialize empty config
+		return
+	}
+
+	if config.Token == "" || len(config.Survey) == 0 {
+		return
+	}
+	if err := config.validate(); err != nil {
+		log.Printf("Error in config file: %v", err)
+		return
+	}
+	if _, retired := sessions.byRetiredToken(config.Token); retired {
+		log.Printf("Skipping config file: token %q was replaced by a new token", config.Token)
+		return
+	}
+	if session, exists := sessions.get(config.Token); exists {
+		// The stored survey wins once anyone answered it, so a restart
+		// never throws answers away
+		stored, _ := yaml.Marshal(session.config())
+		file, _ := yaml.Marshal(config)
+		if bytes.Equal(stored, file) {
+			return
+		}
+		if session.hasAnswers() {
+			log.Printf("Config file differs from the stored survey %q, which already has answers. Using the stored survey.", config.Token)
+			return
+		}
+		log.Printf("Reloading survey %q from the config file", config.Token)
+		session.reset(config)
+		if err := store.SaveConfig(config); err != nil {
+			log.Printf("Error saving config: %v", err)
+		}
+		return
+	}
+
+	if err := store.SaveConfig(config); err != nil {
+		log.Printf("Error saving config: %v", err)
+	}
+	sessions.add(newSession(config))
+}
+
+// restoreState reloads every stored session and its current slide, so a
+// restart picks up where each survey left off.
+func restoreState() {
+	configs, err := store.LoadConfigs()
+	if err != nil {
+		log.Printf("Error loading stored configs: %v", err)
+		return
+	}
+
+	for _, config := range configs {
+		session := newSession(config)
+
+		slide, found, err := store.CurrentSlide(config.Token)
+		if err != nil {
+			log.Printf("Error loading current slide: %v", err)
+		} else if found {
+			session.currentSlide = int32(slide)
+			log.Printf("Restored survey %q at slide %d", config.Name, slide)
+		}
+
+		locked, err := store.LockedSlides(config.Token)
+		if err != nil {
+			log.Printf("Error loading voting locks: %v", err)
+		}
+		for _, slide := range locked {
+			session.lockedSlides.Store(slide, true)
+		}
+
+		// The countdown of a timed slide starts over after a restart
+		session.startTimer(session.slide())
+
+		session.restoreScores()
+		session.restoreQuestions()
+		session.restoreModeration()
+		session.restoreCursors()
+		session.restoreParticipants()
+		session.restoreInvites()
+
+		// Rebuild the counters from the response log
+		for i := range config.Survey {
+			for _, answers := range getResponses(config.Token, i) {
+				session.countAnswers(i, answers)
+			}
+		}
+
+		sessions.add(session)
 	}
+	restoreRetiredTokens()
 }
 
 func generateUserID() (string, error) {
@@ -124,20 +352,25 @@ func generateUserID() (string, error) {
 	return base64.URLEncoding.EncodeToString(b), nil
 }
 
+// getUserID returns the participant ID in the cookie, or hands out a new one.
 func getUserID(c echo.Context) (string, error) {
-	cookie, err := c.Cookie(userIDCookieName)
-	if err == nil {
-		return cookie.Value, nil
+	if userID, ok := participantID(c); ok {
+		return userID, nil
 	}
 
 	userID, err := generateUserID()
 	if err != nil {
 		return "", err
 	}
+	setUserIDCookie(c, userID)
+
+	return userID, nil
+}
 
-	cookie = &http.Cookie{
+func setUserIDCookie(c echo.Context, userID string) {
+	cookie := &http.Cookie{
 		Name:     userIDCookieName,
-		Value:    userID,
+		Value:    signValue(userID),
 		MaxAge:   cookieMaxAge,
 		Expires:  time.Now().Add(cookieMaxAge * time.Second),
 		HttpOnly: true,
@@ -146,12 +379,24 @@ func getUserID(c echo.Context) (string, error) {
 		Path:     "/",
 	}
 	c.SetCookie(cookie)
+}
 
-	return userID, nil
+// participantID returns the participant ID in the cookie, as long as the
+// server signed it.
+func participantID(c echo.Context) (string, bool) {
+	cookie, err := c.Cookie(userIDCookieName)
+	if err != nil {
+		return "", false
+	}
+	userID, ok := verifyValue(cookie.Value)
+	if !ok {
+		log.Printf("Rejected participant cookie with a bad signature from %s", c.RealIP())
+	}
+	return userID, ok
 }
 
 func handleIndex(c echo.Context) error {
-	if len(config.Survey) == 0 {
+	if sessions.count() == 0 {
 		return c.Redirect(http.StatusSeeOther, "/upload")
 	}
 	return c.Render(http.StatusOK, "index.html", nil)
@@ -195,22 +440,50 @@ func handleUpload(c echo.Context) error {
 	if newConfig.Name == "" || newConfig.Token == "" || newConfig.Secret == "" || len(newConfig.Survey) == 0 {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid config structure"})
 	}
+	if err := newConfig.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	// A secret has to lead to one survey only. Hashes of the same secret with
+	// different salts cannot be told apart here, so logins with a secret that
+	// matches several surveys are refused as well.
+	// Comparing the secret with hashed secrets takes a while
+	if !allowSecretAttempt(c.RealIP()) {
+		log.Printf("Rate limited uploads from %s", c.RealIP())
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Too many attempts, please wait a minute"})
+	}
+	if sessions.secretTaken(newConfig.Secret, newConfig.Token) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Secret is already in use"})
+	}
 
-	// Update the current config
-	resetGlobals()
-	config = newConfig
+	// Uploading a survey with an existing token restarts that session only
+	// and is reserved for the presenter who owns it. A hashed secret proves
+	// nothing, so that takes a presenter login.
+	session, exists := sessions.get(newConfig.Token)
+	if exists && !isPresenterOf(c, session) && !secretMatches(session.config().Secret, newConfig.Secret) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Token is already in use"})
+	}
+	if _, retired := sessions.byRetiredToken(newConfig.Token); retired {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Token is already in use"})
+	}
 
-	// Create a new cookie with the secret token
-	cookie := new(http.Cookie)
-	cookie.Name = userIDCookieName
-	cookie.Value = config.Secret
-	cookie.HttpOnly = true
-	cookie.Secure = c.Request().TLS != nil
-	cookie.SameSite = http.SameSiteStrictMode
-	cookie.Path = "/"
+	if exists {
+		session.reset(newConfig)
+	} else {
+		if err := store.Reset(newConfig.Token); err != nil {
+			log.Printf("Error resetting store: %v", err)
+		}
+		session = newSession(newConfig)
+		sessions.add(session)
+	}
+	if err := store.SaveConfig(newConfig); err != nil {
+		log.Printf("Error saving config: %v", err)
+	}
 
-	// Set the cookie
-	c.SetCookie(cookie)
+	if err := startPresenterLogin(c, session); err != nil {
+		log.Printf("Error starting presenter login: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to sign in"})
+	}
 
 	// Return a JSON response indicating success and the redirect URL
 	return c.JSON(http.StatusOK, map[string]string{
@@ -226,19 +499,21 @@ func handleToken(c echo.Context) error {
 		return c.String(http.StatusBadRequest, "Token is required")
 	}
 
-	if token == config.Secret {
-
-		// Create a new cookie with the token
-		cookie := new(http.Cookie)
-		cookie.Name = userIDCookieName
-		cookie.Value = token
-		cookie.HttpOnly = true                 // Makes the cookie inaccessible to JavaScript
-		cookie.Secure = c.Request().TLS != nil // Only send over HTTPS
-		cookie.SameSite = http.SameSiteStrictMode
-		cookie.Path = "/"
+	// Participants are sent on right away, checking the secrets of every
+	// survey takes a while when they are hashed
+	if _, ok := sessions.get(token); ok {
+		return c.Redirect(http.StatusFound, "/survey/"+token)
+	}
+	if !allowSecretAttempt(c.RealIP()) {
+		log.Printf("Rate limited presenter secrets from %s", c.RealIP())
+		return c.String(http.StatusTooManyRequests, "Too many attempts, please wait a minute")
+	}
 
-		// Set the cookie
-		c.SetCookie(cookie)
+	if session, ok := sessions.bySecret(token); ok {
+		if err := startPresenterLogin(c, session); err != nil {
+			log.Printf("Error starting presenter login: %v", err)
+			return c.String(http.StatusInternalServerError, "Error signing in")
+		}
 
 		// Redirect to the presenter page
 		return c.Redirect(http.StatusFound, "/presenter")
@@ -249,17 +524,31 @@ func handleToken(c echo.Context) error {
 
 func handleCompleted(c echo.Context) error {
 	token := c.Param("token")
-	if token != config.Token {
+	session, ok := sessions.get(token)
+	if !ok {
 		return c.String(http.StatusUnauthorized, "Invalid token")
 	}
+	config := session.config()
+	currentSlide := session.slide()
+
+	if config.isSelfPaced() {
+		userID, err := getUserID(c)
+		if err != nil {
+			return c.String(http.StatusInternalServerError, "Error retrieving user ID")
+		}
+		if session.finished(userID) {
+			return c.Render(http.StatusOK, "completed.html", completedData(session))
+		}
+		return c.Redirect(http.StatusSeeOther, "/survey/"+token)
+	}
 
-	if int(currentSlide) >= len(config.Survey) {
-		return c.Render(http.StatusOK, "completed.html", nil)
+	if currentSlide >= len(config.Survey) {
+		return c.Render(http.StatusOK, "completed.html", completedData(session))
 	}
 
 	if currentSlide == 0 {
 		return c.Render(http.StatusOK, "waiting.html", map[string]interface{}{
-			"UserCount":  atomic.LoadInt32(&clientCount),
+			"UserCount":  session.hub.clientCount(),
 			"SurveyName": config.Name,
 		})
 	}
@@ -270,51 +559,119 @@ func handleCompleted(c echo.Context) error {
 }
 
 func handlePresenter(c echo.Context) error {
-	// Retrieve the token from the cookie
-	cookie, err := c.Cookie(userIDCookieName)
-	if err != nil || cookie.Value != config.Secret {
-		return c.String(http.StatusUnauthorized, "Unauthorized")
-	}
+	session := controlledSession(c)
+	config := session.config()
 
 	return c.Render(http.StatusOK, "presenter.html", map[string]interface{}{
 		"Token":        config.Token,
 		"SurveyName":   config.Name,
-		"CurrentSlide": currentSlide,
+		"CurrentSlide": session.slide(),
+		"Slides":       config.Survey,
+		"QA":           config.Questions,
+		"Moderation":   config.hasModeration(),
+		"Other":        config.hasOther(),
+		"OtherSlides":  config.otherSlides(),
+		"SelfPaced":    config.isSelfPaced(),
+		"Progress":     session.progress(),
+		"InviteOnly":   config.isInviteOnly(),
+		"Invites":      session.inviteStatus(),
 	})
 }
 
 func handleSurvey(c echo.Context) error {
 	token := c.Param("token")
-	if token != config.Token {
+	session, ok := sessions.get(token)
+	if !ok {
 		return c.String(http.StatusUnauthorized, "Invalid token")
 	}
+	config := session.config()
+	currentSlide := session.slide()
+
+	var userID string
+	if config.isInviteOnly() {
+		// The code is swapped for a participant cookie, so it does not stay
+		// in the address bar
+		if code := c.QueryParam("code"); code != "" {
+			if !config.hasInviteCode(code) {
+				log.Printf("Rejected invite code from %s", c.RealIP())
+				return c.String(http.StatusForbidden, "Invalid invite code")
+			}
+			if _, err := session.redeemInvite(c, code); err != nil {
+				return c.String(http.StatusInternalServerError, "Error generating user ID")
+			}
+			return c.Redirect(http.StatusSeeOther, "/survey/"+token)
+		}
+		var ok bool
+		if userID, ok = session.invitedParticipant(c); !ok {
+			return c.String(http.StatusForbidden, "This survey needs an invite code")
+		}
+	} else {
+		var err error
+		if userID, err = getUserID(c); err != nil {
+			return c.String(http.StatusInternalServerError, "Error generating user ID")
+		}
+	}
+	session.join(userID)
 
-	userID, err := getUserID(c)
-	if err != nil {
-		return c.String(http.StatusInternalServerError, "Error generating user ID")
+	if config.isSelfPaced() {
+		currentSlide = session.cursor(userID)
+		// Skip slides that were answered before the cursor was saved
+		for currentSlide < len(config.Survey) && hasUserAnswered(token, currentSlide, userID) {
+			currentSlide = session.advanceCursor(userID, currentSlide)
+		}
 	}
 
-	if int(currentSlide) >= len(config.Survey) {
-		return c.Render(http.StatusOK, "completed.html", nil)
+	if currentSlide >= len(config.Survey) {
+		return c.Render(http.StatusOK, "completed.html", completedData(session))
 	}
 
 	if currentSlide == -1 {
 		return c.Render(http.StatusOK, "waiting.html", map[string]interface{}{
-			"UserCount":  atomic.LoadInt32(&clientCount),
+			"UserCount":  session.hub.clientCount(),
 			"SurveyName": config.Name,
+			"Token":      token,
+			"IsQuiz":     config.isQuiz(),
+			"Nickname":   session.quiz.nickname(userID),
+			"QA":         config.Questions,
 		})
 	}
 
-	if hasUserAnswered(token, int(currentSlide), userID) {
+	// Participants the slide is not shown to follow the results instead
+	slide := config.Survey[currentSlide]
+	if slide.Type == leaderboardSlideType || hasUserAnswered(token, currentSlide, userID) || !session.showsTo(currentSlide, userID) {
 		return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/results/%s", token))
 	}
 
+	return c.Render(http.StatusOK, "survey.html", surveyData(session, currentSlide))
+}
+
+// surveyData returns what survey.html needs to show slide.
+func surveyData(session *Session, currentSlide int) map[string]interface{} {
+	config := session.config()
 	slide := config.Survey[currentSlide]
-	return c.Render(http.StatusOK, "survey.html", map[string]interface{}{
-		"Slide":      slide,
-		"Token":      token,
-		"SurveyName": config.Name,
-	})
+
+	data := map[string]interface{}{
+		"Slide":        slide,
+		"Token":        config.Token,
+		"SurveyName":   config.Name,
+		"VotingLocked": session.votingLocked(currentSlide),
+		"QA":           config.Questions,
+		"Required":     slide.isRequired(),
+	}
+	if slide.isNumeric() {
+		minLabel, maxLabel := slide.scaleLabels()
+		data["ScaleValues"] = slide.scaleValues()
+		data["MinLabel"] = minLabel
+		data["MaxLabel"] = maxLabel
+	}
+	if slide.Type == rankingSlideType {
+		positions := make([]int, slide.rankLength())
+		for i := range positions {
+			positions[i] = i + 1
+		}
+		data["RankPositions"] = positions
+	}
+	return data
 }
 
 func clearUserIDCookie(c echo.Context) {
@@ -333,118 +690,157 @@ func clearUserIDCookie(c echo.Context) {
 
 func handleSubmit(c echo.Context) error {
 	token := c.Param("token")
-	if token != config.Token {
+	session, ok := sessions.get(token)
+	if !ok {
 		return c.String(http.StatusUnauthorized, "Invalid token")
 	}
+	config := session.config()
+	currentSlide := session.slide()
+
+	// Answers are only taken from participants who opened the survey page,
+	// which hands out a signed ID
+	userID, ok := participantID(c)
+	if !ok {
+		log.Printf("Rejected answer without a participant ID from %s", c.RealIP())
+		return c.Redirect(http.StatusSeeOther, "/survey/"+token)
+	}
+	if !session.allowSubmit(c.RealIP(), userID) {
+		log.Printf("Rate limited answers from %s, participant %.8s", c.RealIP(), userID)
+		return c.String(http.StatusTooManyRequests, "Too many answers, please slow down")
+	}
 
-	userID, err := getUserID(c)
-	if err != nil {
-		return c.String(http.StatusInternalServerError, "Error generating user ID")
+	// Participants of a self-paced survey go on to their next slide instead
+	// of the live results
+	next := "/results/" + token
+	if config.isSelfPaced() {
+		currentSlide = session.cursor(userID)
+		next = "/survey/" + token
 	}
 
-	if hasUserAnswered(token, int(currentSlide), userID) {
-		return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/results/%s", token))
+	if hasUserAnswered(token, currentSlide, userID) {
+		log.Printf("Rejected second answer on slide %d from %s, participant %.8s", currentSlide+1, c.RealIP(), userID)
+		return c.Redirect(http.StatusSeeOther, next)
 	}
 
-	if currentSlide < 0 || int(currentSlide) >= len(config.Survey) {
+	if currentSlide < 0 || currentSlide >= len(config.Survey) {
 		return c.String(http.StatusBadRequest, "Invalid slide number")
 	}
 
-	slide := config.Survey[currentSlide]
-	var selectedAnswers []string
+	if session.votingLocked(currentSlide) {
+		return c.String(http.StatusForbidden, "Voting is closed")
+	}
 
-	if slide.Type == "multiple" {
-		err := c.Request().ParseForm()
-		if err != nil {
-			return c.String(http.StatusBadRequest, "Error parsing form data")
-		}
-		selectedAnswers = c.Request().Form["answers"]
-		if len(selectedAnswers) == 0 {
-			body, err := io.ReadAll(c.Request().Body)
-			if err != nil {
-				return c.String(http.StatusBadRequest, "Error reading request body")
-			}
+	slide := config.Survey[currentSlide]
+	if slide.Type == leaderboardSlideType {
+		return c.String(http.StatusBadRequest, "This slide does not take answers")
+	}
+	if !session.showsTo(currentSlide, userID) {
+		return c.String(http.StatusForbidden, "This question is not for you")
+	}
+	if err := c.Request().ParseForm(); err != nil {
+		return c.String(http.StatusBadRequest, "Error parsing form data")
+	}
+	selectedAnswers, err := slide.readAnswers(c.Request().Form)
+	if err != nil {
+		// Show the question again with the error and what was filled in
+		data := surveyData(session, currentSlide)
+		data["Error"] = err.Error()
+		data["Submitted"] = c.Request().Form
+		return c.Render(http.StatusUnprocessableEntity, "survey.html", data)
+	}
 
-			bodyStr := string(body)
-			pairs := strings.Split(bodyStr, "&")
-			for _, pair := range pairs {
-				kv := strings.Split(pair, "=")
-				if len(kv) == 2 && kv[0] == "answers" {
-					selectedAnswers = append(selectedAnswers, kv[1])
-				}
-			}
-		}
-	} else {
-		answer := c.FormValue("answer")
-		selectedAnswers = []string{answer}
+	stored, err := session.storeAnswers(currentSlide, userID, selectedAnswers)
+	if err != nil {
+		log.Printf("Error storing answers: %v", err)
+		return c.String(http.StatusInternalServerError, "Error storing answers")
 	}
 
-	answerFound := slide.Type == "text"
-	for _, a := range slide.Answers {
-		for _, answer := range selectedAnswers {
-			if answer == a {
-				answerFound = true
-			}
-		}
+	if stored {
+		session.resultsChanged(currentSlide)
+		session.checkAllAnswered(currentSlide)
 	}
-	if !answerFound {
-		return c.String(http.StatusBadRequest, "Invalid answer submitted")
+	if config.isSelfPaced() && session.advanceCursor(userID, currentSlide) >= len(config.Survey) {
+		next = "/completed/" + token
 	}
 
-	storeAnswers(token, int(currentSlide), userID, selectedAnswers)
-
-	results := getResults(token)
-	broadcast <- Message{Type: "newAnswer", Payload: results}
+	return c.Redirect(http.StatusSeeOther, next)
+}
 
-	return c.Redirect(http.StatusSeeOther, "/results/"+token)
+// storeAnswers records the answers of userID in the response log and counts
+// them. It reports false if the user had already answered the slide.
+func (s *Session) storeAnswers(slide int, userID string, newAnswers []string) (bool, error) {
+	stored, err := store.SaveAnswers(s.config().Token, slide, userID, newAnswers)
+	if err != nil || !stored {
+		return false, err
+	}
+	s.countAnswers(slide, newAnswers)
+	s.scoreAnswers(slide, userID, newAnswers)
+	if s.config().Survey[slide].isModerated() && len(newAnswers) > 0 {
+		s.holdForModeration(slide, newAnswers)
+	}
+	return true, nil
 }
 
-func storeAnswers(token string, slide int, userID string, newAnswers []string) {
-	key := fmt.Sprintf("%s:%d", token, slide)
-	if existingAns, ok := answers.Load(key); ok {
-		answers.Store(key, append(existingAns.([]string), newAnswers...))
-	} else {
-		answers.Store(key, newAnswers)
+// countAnswers adds the answers of one respondent to the live results.
+// Moderated answers are only counted once they are approved.
+func (s *Session) countAnswers(slide int, answers []string) {
+	if s.config().Survey[slide].isModerated() {
+		s.tally.slide(slide).addRespondent()
+		return
+	}
+	if s.config().Survey[slide].Type == rankingSlideType {
+		s.tally.slide(slide).addRanking(answers)
+		return
 	}
-	userKey := fmt.Sprintf("%s:%d:%s", token, slide, userID)
-	userResponses.Store(userKey, true)
+	if s.config().Survey[slide].Type == "text" {
+		s.tally.slide(slide).add(s.countedTerms(slide, answers))
+		return
+	}
+	// The free text of "Other" answers is not counted, only the choice
+	answers, _ = s.config().Survey[slide].splitOther(answers)
+	s.tally.slide(slide).add(answers)
 }
 
-func getAnswers(key string) []string {
-	if existingAns, ok := answers.Load(key); ok {
-		return existingAns.([]string)
+func getResponses(token string, slide int) map[string][]string {
+	responses, err := store.Responses(token, slide)
+	if err != nil {
+		log.Printf("Error loading answers: %v", err)
+		return map[string][]string{}
 	}
-	return []string{}
+	return responses
 }
 
 func hasUserAnswered(token string, slide int, userID string) bool {
-	userKey := fmt.Sprintf("%s:%d:%s", token, slide, userID)
-	_, answered := userResponses.Load(userKey)
+	answered, err := store.HasAnswered(token, slide, userID)
+	if err != nil {
+		log.Printf("Error checking answers: %v", err)
+	}
 	return answered
 }
 
-func getResults(token string) map[string]int {
-	results := make(map[string]int)
-	key := fmt.Sprintf("%s:%d", token, currentSlide)
-	for _, answer := range getAnswers(key) {
-		results[answer]++
-	}
-	return results
+func (s *Session) getResults(slide int) map[string]int {
+	return s.tally.slide(slide).snapshot()
 }
 
 func handleResults(c echo.Context) error {
 	token := c.Param("token")
-	if token != config.Token {
+	session, ok := sessions.get(token)
+	if !ok {
 		return c.String(http.StatusUnauthorized, "Invalid token")
 	}
+	config := session.config()
+	currentSlide := session.slide()
+	if currentSlide < 0 || currentSlide >= len(config.Survey) {
+		return c.Redirect(http.StatusSeeOther, "/survey/"+token)
+	}
 
 	userID, err := getUserID(c)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, "Error retrieving user ID")
 	}
 
-	results := getResults(token)
-	hasAnswered := hasUserAnswered(token, int(currentSlide), userID)
+	results := session.getResults(currentSlide)
+	hasAnswered := hasUserAnswered(token, currentSlide, userID)
 
 	// Create a slice to store results in order
 	orderedResults := make([]struct {
@@ -453,7 +849,16 @@ func handleResults(c echo.Context) error {
 	}, len(config.Survey[currentSlide].Answers))
 
 	// Populate the orderedResults slice
-	if config.Survey[currentSlide].Type == "text" {
+	if config.Survey[currentSlide].isNumeric() {
+		// Every value on the scale gets a bar, also those nobody picked
+		orderedResults = orderedResults[:0]
+		for _, answer := range config.Survey[currentSlide].scaleValues() {
+			orderedResults = append(orderedResults, struct {
+				Answer string
+				Count  int
+			}{Answer: answer, Count: results[answer]})
+		}
+	} else if config.Survey[currentSlide].Type == "text" {
 		// For text responses, we'll return the raw results
 		for answer, count := range results {
 			orderedResults = append(orderedResults, struct {
@@ -478,111 +883,186 @@ func handleResults(c echo.Context) error {
 				Count  int
 			}{Answer: answer, Count: count}
 		}
+		if config.Survey[currentSlide].hasOther() {
+			orderedResults = append(orderedResults, struct {
+				Answer string
+				Count  int
+			}{Answer: otherOption, Count: results[otherOption]})
+		}
 	}
 
-	return c.Render(http.StatusOK, "results.html", map[string]interface{}{
-		"Slide":       config.Survey[currentSlide],
-		"Results":     orderedResults,
-		"HasAnswered": hasAnswered,
-	})
+	slide := config.Survey[currentSlide]
+	if slide.Type == leaderboardSlideType {
+		slide.ResultType = leaderboardSlideType
+	}
+	if slide.Type == matrixSlideType {
+		// Matrix results are always shown as one stacked bar per row
+		slide.ResultType = stackedResultType
+	}
+
+	data := map[string]interface{}{
+		"Slide":        slide,
+		"Results":      orderedResults,
+		"HasAnswered":  hasAnswered,
+		"VotingLocked": session.votingLocked(currentSlide),
+		"IsQuiz":       config.isQuiz(),
+		"Token":        token,
+		"QA":           config.Questions,
+	}
+	if slide.isNumeric() {
+		summary := summarizeScale(slide, results)
+		minLabel, maxLabel := slide.scaleLabels()
+		data["Summary"] = summary
+		data["MinLabel"] = minLabel
+		data["MaxLabel"] = maxLabel
+	}
+	if slide.Type == rankingSlideType {
+		data["Ranking"] = session.rankingResults(currentSlide)
+	}
+	if slide.Type == matrixSlideType {
+		data["Matrix"] = summarizeMatrix(slide, results)
+	}
+	if config.isQuiz() || slide.Type == leaderboardSlideType {
+		data["Leaderboard"] = session.topLeaderboard()
+		data["Score"] = session.quiz.score(userID)
+	}
+	return c.Render(http.StatusOK, "results.html", data)
+}
+
+func completedData(session *Session) map[string]interface{} {
+	if !session.config().isQuiz() {
+		return nil
+	}
+	return map[string]interface{}{
+		"Leaderboard": session.topLeaderboard(),
+	}
 }
 
 func handleWebSocket(c echo.Context) error {
+	session, ok := sessions.get(c.QueryParam("token"))
+	rotated := false
+	if !ok {
+		// Pages opened before the token was rotated are told the new one
+		session, rotated = rotatedSession(c, c.QueryParam("token"))
+		if !rotated {
+			return c.String(http.StatusUnauthorized, "Invalid token")
+		}
+	}
+
 	ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
 	if err != nil {
 		return err
 	}
-	newCount := atomic.AddInt32(&clientCount, 1)
-	// Send the current slide number to the newly connected client
-	err = ws.WriteJSON(Message{Type: "currentSlide", Payload: currentSlide})
-	if err != nil {
-		log.Printf("Error sending current slide: %v", err)
+	client := &Client{hub: session.hub, conn: ws, send: make(chan Message, clientQueueSize)}
+	client.presenter = isPresenterOf(c, session)
+	client.userID, _ = participantID(c)
+	if rotated {
+		client.send <- Message{Type: "tokenChanged", Payload: session.config().Token}
 	}
-
-	clients.Store(ws, true)
-	broadcast <- Message{Type: "userCount", Payload: newCount}
-
-	defer func() {
-		clients.Delete(ws)
-		ws.Close()
-		newCount := atomic.AddInt32(&clientCount, -1)
-		broadcast <- Message{Type: "userCount", Payload: newCount}
-	}()
-	for {
-		var msg Message
-		err := ws.ReadJSON(&msg)
-		if err != nil {
-			break
+	if session.config().isSelfPaced() {
+		// Participants are on slides of their own, the presenter follows
+		// their progress
+		if client.presenter {
+			client.send <- Message{Type: "progress", Payload: session.progress()}
+		}
+	} else {
+		// Send the current slide number to the newly connected client
+		client.send <- Message{Type: "currentSlide", Payload: session.slide()}
+		client.send <- Message{Type: "votingLocked", Payload: session.votingLocked(session.slide())}
+		if remaining, ok := session.timer.remaining(session.slide()); ok {
+			client.send <- Message{Type: "timer", Payload: max(remaining, 0)}
 		}
-		if msg.Type == "emoji" || msg.Type == "emojiPopped" {
-			broadcast <- msg
+	}
+	if client.presenter && session.config().hasModeration() {
+		client.send <- Message{Type: "moderationQueue", Payload: session.pendingModeration()}
+	}
+	if session.config().Questions {
+		client.send <- Message{Type: "questions", Payload: session.qa.list(false)}
+		if client.presenter {
+			client.send <- Message{Type: "presenterQuestions", Payload: session.qa.list(true)}
 		}
 	}
+	session.hub.register <- client
+
+	go client.writePump()
+	client.readPump()
 	return nil
 }
 
 func handleNextSlide(c echo.Context) error {
-	// Check for authentication via cookie or header
-	authenticated := false
+	session := controlledSession(c)
+	config := session.config()
 
-	cookie, err := c.Cookie(userIDCookieName)
-	if err == nil || cookie.Value == config.Secret {
-		authenticated = true
+	if session.slide() >= len(config.Survey) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Survey is already finished"})
 	}
 
-	secret := c.Request().Header.Get("x-token")
-	if secret == config.Secret {
-		authenticated = true
+	if !session.goToSlide(session.slide() + 1) {
+		return c.NoContent(http.StatusSeeOther)
 	}
+	return c.NoContent(http.StatusOK)
+}
 
-	if !authenticated {
-		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid secret"})
-	}
+func handlePreviousSlide(c echo.Context) error {
+	session := controlledSession(c)
+	config := session.config()
 
-	if int(currentSlide) >= len(config.Survey) {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Survey is already finished"})
+	previous := min(session.slide(), len(config.Survey)) - 1
+	if previous < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Already at the first slide"})
 	}
 
-	currentSlide++
-	if int(currentSlide) >= len(config.Survey) {
-		broadcast <- Message{Type: "finished", Payload: true}
-		return c.NoContent(http.StatusSeeOther)
+	session.goToSlide(previous)
+	return c.NoContent(http.StatusOK)
+}
+
+func handleGotoSlide(c echo.Context) error {
+	session := controlledSession(c)
+	config := session.config()
+
+	// Slides are numbered from 1 for the presenter, as in the export
+	slide, err := strconv.Atoi(c.Param("slide"))
+	if err != nil || slide < 1 || slide > len(config.Survey) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid slide number"})
 	}
 
-	broadcast <- Message{Type: "newSlide", Payload: currentSlide}
+	session.goToSlide(slide - 1)
 	return c.NoContent(http.StatusOK)
 }
 
-func handleMessages() {
-	for msg := range broadcast {
-		clients.Range(func(key, value interface{}) bool {
-			client := key.(*websocket.Conn)
-			err := client.WriteJSON(msg)
-			if err != nil {
-				log.Printf("error: %v", err)
-				client.Close()
-				clients.Delete(client)
-			}
-			return true
-		})
+// handleRestartSurvey clears every answer and sends the audience back to the
+// waiting page.
+func handleRestartSurvey(c echo.Context) error {
+	session := controlledSession(c)
+
+	if err := session.clearAnswers(); err != nil {
+		log.Printf("Error resetting store: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to restart survey"})
 	}
+
+	session.goToSlide(-1)
+	return c.NoContent(http.StatusOK)
 }
 
-func resetGlobals() {
-	broadcast <- Message{Type: "shutdown", Payload: "Server is restarting"}
+func handleLockVoting(c echo.Context) error {
+	return setVotingLocked(c, true)
+}
 
-	// Wait for a short period to allow clients to disconnect
-	time.Sleep(1 * time.Second)
+func handleUnlockVoting(c echo.Context) error {
+	return setVotingLocked(c, false)
+}
 
-	currentSlide = -1
-	answers = sync.Map{}
-	clients = sync.Map{}
-	userResponses = sync.Map{}
-	atomic.StoreInt32(&clientCount, 0)
-	// close(broadcast)
-	for len(broadcast) > 0 {
-		<-broadcast
+func setVotingLocked(c echo.Context, locked bool) error {
+	session := controlledSession(c)
+	config := session.config()
+
+	currentSlide := session.slide()
+	if currentSlide < 0 || currentSlide >= len(config.Survey) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "No active slide"})
 	}
+
+	session.setVotingLocked(locked)
+	return c.NoContent(http.StatusOK)
 }
 
 func customErrorHandler(err error, c echo.Context) {
@@ -596,40 +1076,114 @@ func customErrorHandler(err error, c echo.Context) {
 }
 
 func handleExport(c echo.Context) error {
-	// Check authentication
-	cookie, err := c.Cookie(userIDCookieName)
-	if err != nil || cookie.Value != config.Secret {
-		return c.String(http.StatusUnauthorized, "Unauthorized")
-	}
+	session := controlledSession(c)
+	config := session.config()
 
 	// Create a buffer to store our CSV data
 	buf := &bytes.Buffer{}
 	w := csv.NewWriter(buf)
 
-	// Write the header
-	w.Write([]string{"Slide", "Answer", "Count"})
+	// Write the header. Row is only set for the statements of matrix slides,
+	// Other holds the free texts of "Other" answers, one per row.
+	w.Write([]string{"Slide", "Row", "Answer", "Count", "Other"})
 
-	// Iterate through all slides and write their data
-	for i, _ := range config.Survey {
-		key := fmt.Sprintf("%s:%d", config.Token, i)
-		answers := getAnswers(key)
+	// Statistics of numeric slides and the points of ranking slides are
+	// written in sections of their own
+	var statistics, rankings [][]string
 
-		// Count the answers
-		answerCounts := make(map[string]int)
-		for _, answer := range answers {
-			answerCounts[answer]++
+	// Iterate through all slides and write their data
+	for i, slide := range config.Survey {
+		answerCounts := session.getResults(i)
+
+		if slide.Type == matrixSlideType {
+			for _, row := range summarizeMatrix(slide, answerCounts) {
+				for j, column := range slide.Columns {
+					w.Write([]string{
+						strconv.Itoa(i + 1),
+						row.Row,
+						column,
+						strconv.Itoa(row.Counts[j]),
+						"",
+					})
+				}
+			}
+			continue
 		}
 
 		// Write the data for each answer
 		for answer, count := range answerCounts {
 			w.Write([]string{
 				strconv.Itoa(i + 1),
+				"",
 				answer,
 				strconv.Itoa(count),
+				"",
+			})
+		}
+
+		if slide.isNumeric() {
+			for _, row := range scaleSummaryRows(summarizeScale(slide, answerCounts)) {
+				statistics = append(statistics, append([]string{strconv.Itoa(i + 1)}, row...))
+			}
+		}
+		if slide.Type == rankingSlideType {
+			for _, row := range rankingRows(session.rankingResults(i)) {
+				rankings = append(rankings, append([]string{strconv.Itoa(i + 1)}, row...))
+			}
+		}
+		if slide.hasOther() {
+			for _, text := range session.otherTexts(i) {
+				w.Write([]string{strconv.Itoa(i + 1), "", otherOption, "", text})
+			}
+		}
+	}
+
+	if len(statistics) > 0 {
+		w.Write([]string{})
+		w.Write([]string{"Slide", "Statistic", "Value"})
+		for _, row := range statistics {
+			w.Write(row)
+		}
+	}
+	if len(rankings) > 0 {
+		w.Write([]string{})
+		w.Write([]string{"Slide", "Answer", "Points", "Average rank"})
+		for _, row := range rankings {
+			w.Write(row)
+		}
+	}
+
+	if config.Questions {
+		w.Write([]string{})
+		w.Write([]string{"Question", "Votes", "Answered", "Hidden"})
+		for _, q := range session.qa.list(true) {
+			w.Write([]string{
+				q.Text,
+				strconv.Itoa(q.Votes),
+				strconv.FormatBool(q.Answered),
+				strconv.FormatBool(q.Hidden),
 			})
 		}
 	}
 
+	if config.isQuiz() {
+		w.Write([]string{})
+		w.Write([]string{"Rank", "Nickname", "Score"})
+		for _, entry := range session.leaderboard() {
+			w.Write([]string{
+				strconv.Itoa(entry.Rank),
+				entry.Nickname,
+				strconv.Itoa(entry.Score),
+			})
+		}
+	}
+
+	// Invite only surveys list every answer by code, or by an anonymous
+	// respondent number with ?anonymise=true
+	if config.isInviteOnly() {
+		writeInviteResponses(w, session, c.QueryParam("anonymise") == "true")
+	}
+
 	w.Flush()
 
 	if err := w.Error(); err != nil {
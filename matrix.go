@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const (
+	matrixSlideType   = "matrix"
+	stackedResultType = "stacked"
+)
+
+// MatrixRow is the aggregate of one statement of a matrix slide. Counts and
+// Shares follow the order of the columns of the slide, Shares in percent.
+type MatrixRow struct {
+	Row    string    `json:"row"`
+	Counts []int     `json:"counts"`
+	Shares []float64 `json:"shares"`
+	Total  int       `json:"total"`
+}
+
+// matrixCell is the stored answer for picking column in row. The row is
+// kept as its index so statements can contain any text.
+func matrixCell(row int, column string) string {
+	return strconv.Itoa(row) + ":" + column
+}
+
+// matrixAnswers reads one column per row from the form fields "row-0",
+// "row-1", ... and returns them as stored answers.
+func (slide Slide) matrixAnswers(form url.Values) ([]string, error) {
+	answers := make([]string, 0, len(slide.Rows))
+	for i, row := range slide.Rows {
+		column := form.Get(fmt.Sprintf("row-%d", i))
+		if column == "" {
+			return nil, fmt.Errorf("%q has no answer", row)
+		}
+
+		valid := false
+		for _, c := range slide.Columns {
+			if column == c {
+				valid = true
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("%q is not an option", column)
+		}
+		answers = append(answers, matrixCell(i, column))
+	}
+	return answers, nil
+}
+
+// summarizeMatrix splits the counts of a matrix slide by row.
+func summarizeMatrix(slide Slide, results map[string]int) []MatrixRow {
+	rows := make([]MatrixRow, len(slide.Rows))
+	for i, row := range slide.Rows {
+		rows[i] = MatrixRow{
+			Row:    row,
+			Counts: make([]int, len(slide.Columns)),
+			Shares: make([]float64, len(slide.Columns)),
+		}
+		for j, column := range slide.Columns {
+			count := results[matrixCell(i, column)]
+			rows[i].Counts[j] = count
+			rows[i].Total += count
+		}
+		if rows[i].Total == 0 {
+			continue
+		}
+		for j, count := range rows[i].Counts {
+			rows[i].Shares[j] = roundTo(float64(count)*100/float64(rows[i].Total), 1)
+		}
+	}
+	return rows
+}
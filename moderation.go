@@ -0,0 +1,140 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	moderationPending  = "pending"
+	moderationApproved = "approved"
+	moderationRejected = "rejected"
+
+	maxModeratedLength = 280
+)
+
+// ModerationItem is a text answer held back until the presenter approves it.
+type ModerationItem struct {
+	ID        string    `json:"id"`
+	Slide     int       `json:"slide"`
+	Text      string    `json:"text"`
+	Status    string    `json:"status"`
+	Submitted time.Time `json:"submitted"`
+}
+
+// isModerated reports whether text answers to the slide wait for approval
+// before they are counted.
+func (slide Slide) isModerated() bool {
+	return slide.Moderation && slide.Type == "text"
+}
+
+// hasModeration reports whether any slide holds answers for approval.
+func (c Config) hasModeration() bool {
+	for _, slide := range c.Survey {
+		if slide.isModerated() {
+			return true
+		}
+	}
+	return false
+}
+
+// holdForModeration puts the answer of a moderated slide in the queue of the
+// presenter. Text slides take a single answer.
+func (s *Session) holdForModeration(slide int, answers []string) {
+	id, err := newItemID()
+	if err != nil {
+		log.Printf("Error generating moderation ID: %v", err)
+		return
+	}
+	item := ModerationItem{
+		ID:        id,
+		Slide:     slide,
+		Text:      answers[0],
+		Status:    moderationPending,
+		Submitted: time.Now(),
+	}
+	if err := store.SaveModerationItem(s.config().Token, item); err != nil {
+		log.Printf("Error saving moderation item: %v", err)
+		return
+	}
+	s.moderationChanged()
+}
+
+// moderationChanged marks the queue for the next tick of publishResults.
+func (s *Session) moderationChanged() {
+	atomic.StoreInt32(&s.moderationPending, 1)
+}
+
+// pendingModeration returns the answers waiting for the presenter, oldest
+// first.
+func (s *Session) pendingModeration() []ModerationItem {
+	items, err := store.ModerationItems(s.config().Token)
+	if err != nil {
+		log.Printf("Error loading moderation queue: %v", err)
+	}
+	pending := make([]ModerationItem, 0, len(items))
+	for _, item := range items {
+		if item.Status == moderationPending {
+			pending = append(pending, item)
+		}
+	}
+	return pending
+}
+
+// restoreModeration counts the approved answers of moderated slides again.
+func (s *Session) restoreModeration() {
+	items, err := store.ModerationItems(s.config().Token)
+	if err != nil {
+		log.Printf("Error loading moderation queue: %v", err)
+	}
+	for _, item := range items {
+		if item.Status == moderationApproved {
+			s.tally.slide(item.Slide).count(s.countedTerms(item.Slide, []string{item.Text}))
+		}
+	}
+}
+
+// handleModerateAnswer approves or rejects a held back answer. A "text" form
+// value replaces the answer, with no action it only edits the pending answer.
+func handleModerateAnswer(c echo.Context) error {
+	session := controlledSession(c)
+
+	var status string
+	switch c.FormValue("action") {
+	case "approve":
+		status = moderationApproved
+	case "reject":
+		status = moderationRejected
+	case "":
+		status = moderationPending
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid action"})
+	}
+
+	text := strings.TrimSpace(c.FormValue("text"))
+	if utf8.RuneCountInString(text) > maxModeratedLength {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Answer is too long"})
+	}
+
+	item, ok, err := store.Moderate(session.config().Token, c.Param("id"), status, text)
+	if err != nil {
+		log.Printf("Error moderating answer: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Error moderating answer"})
+	}
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "No pending answer found"})
+	}
+
+	if item.Status == moderationApproved {
+		session.tally.slide(item.Slide).count(session.countedTerms(item.Slide, []string{item.Text}))
+		session.resultsChanged(item.Slide)
+	}
+	session.moderationChanged()
+	return c.NoContent(http.StatusOK)
+}
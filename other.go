@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// The extra choice of slides with allowOther, counted as its own bucket
+	otherOption = "Other"
+
+	// The free text of an "Other" answer is stored next to the choices with
+	// this prefix
+	otherTextPrefix = "Other: "
+)
+
+// hasOther reports whether the slide offers an "Other" choice.
+func (slide Slide) hasOther() bool {
+	return slide.AllowOther && (slide.Type == "multiple" || slide.Type == "radio")
+}
+
+// readOther adds the free text of an "Other" answer to answers. It is only
+// required once "Other" is picked.
+func (slide Slide) readOther(answers []string, other string) ([]string, error) {
+	picked := false
+	for _, answer := range answers {
+		if answer == otherOption {
+			picked = true
+		}
+	}
+	if !picked {
+		return answers, nil
+	}
+
+	other = strings.TrimSpace(other)
+	if other == "" {
+		return nil, errors.New("Please specify your other answer")
+	}
+	if utf8.RuneCountInString(other) > slide.maxTextLength() {
+		return nil, fmt.Errorf("Other answer must be at most %d characters", slide.maxTextLength())
+	}
+	return append(answers, otherTextPrefix+other), nil
+}
+
+// hasOther reports whether any slide of the survey offers an "Other" choice.
+func (c Config) hasOther() bool {
+	for _, slide := range c.Survey {
+		if slide.hasOther() {
+			return true
+		}
+	}
+	return false
+}
+
+// validateOther rejects an "Other" choice next to an answer of the same name,
+// as the two could not be told apart.
+func (slide Slide) validateOther() error {
+	if !slide.hasOther() {
+		return nil
+	}
+	for _, answer := range slide.Answers {
+		if answer == otherOption {
+			return fmt.Errorf("allowOther adds %q, which is already one of the answers", otherOption)
+		}
+	}
+	return nil
+}
+
+// otherSlides reports for every slide whether it offers an "Other" choice.
+func (c Config) otherSlides() []bool {
+	slides := make([]bool, len(c.Survey))
+	for i, slide := range c.Survey {
+		slides[i] = slide.hasOther()
+	}
+	return slides
+}
+
+// splitOther separates stored answers into the choices and the free text of
+// an "Other" answer.
+func (slide Slide) splitOther(answers []string) ([]string, string) {
+	if !slide.hasOther() {
+		return answers, ""
+	}
+	choices := make([]string, 0, len(answers))
+	other := ""
+	for _, answer := range answers {
+		if strings.HasPrefix(answer, otherTextPrefix) && slide.validateChoice(answer) != nil {
+			other = strings.TrimPrefix(answer, otherTextPrefix)
+			continue
+		}
+		choices = append(choices, answer)
+	}
+	return choices, other
+}
+
+// otherTexts returns every free text given as "Other" on slide, sorted.
+func (s *Session) otherTexts(slide int) []string {
+	survey := s.config().Survey
+	texts := []string{}
+	for _, answers := range getResponses(s.config().Token, slide) {
+		if _, other := survey[slide].splitOther(answers); other != "" {
+			texts = append(texts, other)
+		}
+	}
+	sort.Strings(texts)
+	return texts
+}
+
+// handleOtherTexts lets the presenter drill into the "Other" answers of a
+// slide, numbered from 1.
+func handleOtherTexts(c echo.Context) error {
+	session := controlledSession(c)
+	config := session.config()
+
+	slide, err := strconv.Atoi(c.Param("slide"))
+	if err != nil || slide < 1 || slide > len(config.Survey) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid slide number"})
+	}
+
+	return c.JSON(http.StatusOK, session.otherTexts(slide-1))
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	maxQuestionLength = 280
+	// Most questions the Q&A board of a survey takes
+	maxQuestions = 500
+)
+
+// Question is an entry on the audience Q&A board.
+type Question struct {
+	ID       string    `json:"id"`
+	Text     string    `json:"text"`
+	Votes    int       `json:"votes"`
+	Answered bool      `json:"answered"`
+	Hidden   bool      `json:"hidden"`
+	Asked    time.Time `json:"asked"`
+}
+
+// qaBoard keeps the questions of a session in memory. The store records who
+// upvoted what, so every user can vote for a question only once.
+type qaBoard struct {
+	mu        sync.Mutex
+	questions map[string]*Question
+}
+
+func (b *qaBoard) add(q Question) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.questions == nil {
+		b.questions = make(map[string]*Question)
+	}
+	b.questions[q.ID] = &q
+}
+
+func (b *qaBoard) size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.questions)
+}
+
+func (b *qaBoard) get(id string) (Question, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q, ok := b.questions[id]
+	if !ok {
+		return Question{}, false
+	}
+	return *q, true
+}
+
+// update changes the question id with fn and returns the result.
+func (b *qaBoard) update(id string, fn func(q *Question)) (Question, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q, ok := b.questions[id]
+	if !ok {
+		return Question{}, false
+	}
+	fn(q)
+	return *q, true
+}
+
+// list returns the questions with the most votes first. Hidden questions are
+// only included for the presenter.
+func (b *qaBoard) list(includeHidden bool) []Question {
+	b.mu.Lock()
+	questions := make([]Question, 0, len(b.questions))
+	for _, q := range b.questions {
+		if includeHidden || !q.Hidden {
+			questions = append(questions, *q)
+		}
+	}
+	b.mu.Unlock()
+
+	sort.Slice(questions, func(i, j int) bool {
+		if questions[i].Votes != questions[j].Votes {
+			return questions[i].Votes > questions[j].Votes
+		}
+		return questions[i].Asked.Before(questions[j].Asked)
+	})
+	return questions
+}
+
+func (b *qaBoard) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.questions = nil
+}
+
+// newItemID returns a random ID for questions and moderated answers.
+func newItemID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// questionsChanged marks the Q&A board for the next tick of publishResults.
+func (s *Session) questionsChanged() {
+	atomic.StoreInt32(&s.questionsPending, 1)
+}
+
+// publishQuestions sends the board to the audience and, including hidden
+// questions, to the presenter.
+func (s *Session) publishQuestions() {
+	s.hub.broadcast <- Message{Type: "questions", Payload: s.qa.list(false)}
+	s.hub.broadcast <- Message{Type: "presenterQuestions", Payload: s.qa.list(true), presenterOnly: true}
+}
+
+// restoreQuestions reloads the Q&A board from the store.
+func (s *Session) restoreQuestions() {
+	questions, err := store.Questions(s.config().Token)
+	if err != nil {
+		log.Printf("Error loading questions: %v", err)
+	}
+	for _, q := range questions {
+		s.qa.add(q)
+	}
+}
+
+func handleQuestions(c echo.Context) error {
+	token := c.Param("token")
+	session, ok := sessions.get(token)
+	if !ok {
+		return c.String(http.StatusUnauthorized, "Invalid token")
+	}
+	if !session.config().Questions {
+		return c.String(http.StatusNotFound, "This survey has no Q&A")
+	}
+	config := session.config()
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error generating user ID")
+	}
+	upvoted, err := store.Upvoted(token, userID)
+	if err != nil {
+		log.Printf("Error loading upvotes: %v", err)
+	}
+
+	return c.Render(http.StatusOK, "questions.html", map[string]interface{}{
+		"Token":      token,
+		"SurveyName": config.Name,
+		"Questions":  session.qa.list(false),
+		"Upvoted":    upvoted,
+		"MaxLength":  maxQuestionLength,
+	})
+}
+
+func handleAskQuestion(c echo.Context) error {
+	token := c.Param("token")
+	session, ok := sessions.get(token)
+	if !ok {
+		return c.String(http.StatusUnauthorized, "Invalid token")
+	}
+	if !session.config().Questions {
+		return c.String(http.StatusNotFound, "This survey has no Q&A")
+	}
+
+	// Questions are only taken from participants who opened the Q&A board,
+	// so they can be rate limited like answers
+	userID, ok := participantID(c)
+	if !ok {
+		log.Printf("Rejected question without a participant ID from %s", c.RealIP())
+		return c.Redirect(http.StatusSeeOther, "/questions/"+token)
+	}
+	if !session.allowSubmit(c.RealIP(), userID) {
+		log.Printf("Rate limited questions from %s, participant %.8s", c.RealIP(), userID)
+		return c.String(http.StatusTooManyRequests, "Too many questions, please slow down")
+	}
+
+	text := strings.TrimSpace(c.FormValue("question"))
+	if text == "" || utf8.RuneCountInString(text) > maxQuestionLength {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("Question must be 1 to %d characters", maxQuestionLength))
+	}
+	if session.qa.size() >= maxQuestions {
+		return c.String(http.StatusConflict, "The Q&A board is full")
+	}
+
+	id, err := newItemID()
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error generating question ID")
+	}
+	q := Question{ID: id, Text: text, Asked: time.Now()}
+	if err := store.SaveQuestion(token, q); err != nil {
+		log.Printf("Error saving question: %v", err)
+		return c.String(http.StatusInternalServerError, "Error saving question")
+	}
+	session.qa.add(q)
+	session.questionsChanged()
+
+	return c.Redirect(http.StatusSeeOther, "/questions/"+token)
+}
+
+func handleUpvoteQuestion(c echo.Context) error {
+	token := c.Param("token")
+	session, ok := sessions.get(token)
+	if !ok {
+		return c.String(http.StatusUnauthorized, "Invalid token")
+	}
+	if !session.config().Questions {
+		return c.String(http.StatusNotFound, "This survey has no Q&A")
+	}
+
+	// Upvotes count once per participant, so they are only taken from
+	// participants who opened the Q&A board, which hands out a signed ID
+	userID, ok := participantID(c)
+	if !ok {
+		log.Printf("Rejected upvote without a participant ID from %s", c.RealIP())
+		return c.Redirect(http.StatusSeeOther, "/questions/"+token)
+	}
+	if !session.allowSubmit(c.RealIP(), userID) {
+		log.Printf("Rate limited upvotes from %s, participant %.8s", c.RealIP(), userID)
+		return c.String(http.StatusTooManyRequests, "Too many upvotes, please slow down")
+	}
+
+	id := c.Param("id")
+	if q, ok := session.qa.get(id); !ok || q.Hidden {
+		return c.String(http.StatusNotFound, "Question not found")
+	}
+
+	upvoted, err := store.SaveUpvote(token, id, userID)
+	if err != nil {
+		log.Printf("Error saving upvote: %v", err)
+		return c.String(http.StatusInternalServerError, "Error saving upvote")
+	}
+	if upvoted {
+		session.qa.update(id, func(q *Question) { q.Votes++ })
+		session.questionsChanged()
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/questions/"+token)
+}
+
+// handleModerateQuestion lets the presenter mark a question answered or hide
+// it, with the form values "answered" and "hidden".
+func handleModerateQuestion(c echo.Context) error {
+	session := controlledSession(c)
+
+	answered, err := optionalBool(c.FormValue("answered"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid value for answered"})
+	}
+	hidden, err := optionalBool(c.FormValue("hidden"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid value for hidden"})
+	}
+
+	q, ok := session.qa.update(c.Param("id"), func(q *Question) {
+		if answered != nil {
+			q.Answered = *answered
+		}
+		if hidden != nil {
+			q.Hidden = *hidden
+		}
+	})
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Question not found"})
+	}
+
+	if err := store.SaveQuestion(session.config().Token, q); err != nil {
+		log.Printf("Error saving question: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Error saving question"})
+	}
+	session.questionsChanged()
+	return c.NoContent(http.StatusOK)
+}
+
+// optionalBool parses value, returning nil if it is empty.
+func optionalBool(value string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Slides of this type show the quiz standings instead of a question
+	leaderboardSlideType = "leaderboard"
+
+	maxNicknameLength = 24
+	leaderboardSize   = 10
+)
+
+// LeaderboardEntry is the standing of one participant in a quiz.
+type LeaderboardEntry struct {
+	Rank     int    `json:"rank"`
+	Nickname string `json:"nickname"`
+	Score    int    `json:"score"`
+}
+
+// quizScores keeps the running score and nickname of every participant.
+type quizScores struct {
+	scores    sync.Map // userID -> *int64
+	nicknames sync.Map // userID -> string
+}
+
+func (q *quizScores) add(userID string, points int) {
+	score, _ := q.scores.LoadOrStore(userID, new(int64))
+	atomic.AddInt64(score.(*int64), int64(points))
+}
+
+func (q *quizScores) score(userID string) int {
+	if score, ok := q.scores.Load(userID); ok {
+		return int(atomic.LoadInt64(score.(*int64)))
+	}
+	return 0
+}
+
+func (q *quizScores) nickname(userID string) string {
+	if nickname, ok := q.nicknames.Load(userID); ok {
+		return nickname.(string)
+	}
+	return ""
+}
+
+func (q *quizScores) reset() {
+	q.scores.Range(func(key, _ interface{}) bool {
+		q.scores.Delete(key)
+		return true
+	})
+	q.nicknames.Range(func(key, _ interface{}) bool {
+		q.nicknames.Delete(key)
+		return true
+	})
+}
+
+// isQuiz reports whether any slide has correct answers to score against.
+func (c Config) isQuiz() bool {
+	for _, slide := range c.Survey {
+		if len(slide.Correct) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isCorrect reports whether answers match the correct answers of the slide
+// exactly. Text answers are compared without regard to case, rankings must
+// also be in the right order.
+func (slide Slide) isCorrect(answers []string) bool {
+	if len(slide.Correct) == 0 || len(answers) != len(slide.Correct) {
+		return false
+	}
+	if slide.Type == rankingSlideType {
+		for i, answer := range answers {
+			if answer != slide.Correct[i] {
+				return false
+			}
+		}
+		return true
+	}
+	matched := make(map[string]bool)
+	for _, answer := range answers {
+		for _, correct := range slide.Correct {
+			if answer == correct || (slide.Type == "text" && strings.EqualFold(strings.TrimSpace(answer), strings.TrimSpace(correct))) {
+				matched[correct] = true
+			}
+		}
+	}
+	return len(matched) == len(slide.Correct)
+}
+
+// scoreAnswers awards the points of slide to userID if the answers are
+// correct. Timed slides add a speed bonus that shrinks as the clock runs down.
+func (s *Session) scoreAnswers(slide int, userID string, answers []string) {
+	config := s.config()
+	if !config.Survey[slide].isCorrect(answers) {
+		return
+	}
+
+	points := config.Survey[slide].Points
+	if points == 0 {
+		points = 1
+	}
+	limit := int(config.Survey[slide].TimeLimit.Seconds())
+	if remaining, ok := s.timer.remaining(slide); ok && limit > 0 {
+		points += config.Survey[slide].SpeedBonus * max(remaining, 0) / limit
+	}
+
+	if err := store.SaveScore(config.Token, slide, userID, points); err != nil {
+		log.Printf("Error saving score: %v", err)
+	}
+	s.quiz.add(userID, points)
+}
+
+// leaderboard returns the participants ranked by score. Participants with the
+// same score share a rank.
+func (s *Session) leaderboard() []LeaderboardEntry {
+	// Everyone who scored or picked a nickname is on the board
+	players := make(map[string]bool)
+	for _, m := range []*sync.Map{&s.quiz.scores, &s.quiz.nicknames} {
+		m.Range(func(key, _ interface{}) bool {
+			players[key.(string)] = true
+			return true
+		})
+	}
+
+	entries := make([]LeaderboardEntry, 0, len(players))
+	for userID := range players {
+		nickname := s.quiz.nickname(userID)
+		if nickname == "" {
+			nickname = fmt.Sprintf("Player %.4s", userID)
+		}
+		entries = append(entries, LeaderboardEntry{Nickname: nickname, Score: s.quiz.score(userID)})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Score != entries[j].Score {
+			return entries[i].Score > entries[j].Score
+		}
+		return entries[i].Nickname < entries[j].Nickname
+	})
+	for i := range entries {
+		entries[i].Rank = i + 1
+		if i > 0 && entries[i].Score == entries[i-1].Score {
+			entries[i].Rank = entries[i-1].Rank
+		}
+	}
+	return entries
+}
+
+// topLeaderboard returns the first leaderboardSize entries of the leaderboard.
+func (s *Session) topLeaderboard() []LeaderboardEntry {
+	entries := s.leaderboard()
+	if len(entries) > leaderboardSize {
+		entries = entries[:leaderboardSize]
+	}
+	return entries
+}
+
+// restoreScores reloads scores and nicknames from the store.
+func (s *Session) restoreScores() {
+	token := s.config().Token
+	scores, err := store.Scores(token)
+	if err != nil {
+		log.Printf("Error loading scores: %v", err)
+	}
+	for userID, score := range scores {
+		s.quiz.add(userID, score)
+	}
+
+	nicknames, err := store.Nicknames(token)
+	if err != nil {
+		log.Printf("Error loading nicknames: %v", err)
+	}
+	for userID, nickname := range nicknames {
+		s.quiz.nicknames.Store(userID, nickname)
+	}
+}
+
+func handleNickname(c echo.Context) error {
+	token := c.Param("token")
+	session, ok := sessions.get(token)
+	if !ok {
+		return c.String(http.StatusUnauthorized, "Invalid token")
+	}
+
+	userID, ok := participantID(c)
+	if !ok {
+		log.Printf("Rejected nickname without a participant ID from %s", c.RealIP())
+		return c.Redirect(http.StatusSeeOther, "/survey/"+token)
+	}
+	if !session.allowSubmit(c.RealIP(), userID) {
+		log.Printf("Rate limited nicknames from %s, participant %.8s", c.RealIP(), userID)
+		return c.String(http.StatusTooManyRequests, "Too many requests, please slow down")
+	}
+
+	nickname := strings.TrimSpace(c.FormValue("nickname"))
+	if nickname == "" || utf8.RuneCountInString(nickname) > maxNicknameLength {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("Nickname must be 1 to %d characters", maxNicknameLength))
+	}
+
+	if err := store.SaveNickname(token, userID, nickname); err != nil {
+		log.Printf("Error saving nickname: %v", err)
+		return c.String(http.StatusInternalServerError, "Error saving nickname")
+	}
+	session.quiz.nicknames.Store(userID, nickname)
+
+	return c.Redirect(http.StatusSeeOther, "/survey/"+token)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+const (
+	rankingSlideType = "ranking"
+
+	// Ranking slides with this result type show the options ordered by
+	// their Borda count
+	rankedResultType = "ranked"
+)
+
+// RankingResult is the aggregate of one option of a ranking slide.
+type RankingResult struct {
+	Answer string `json:"answer"`
+	// Points is the Borda count: with n options, first place is worth n
+	// points, second place n-1 and so on. Unranked options get nothing.
+	Points int `json:"points"`
+	// AverageRank is the mean position among the participants who ranked
+	// the option, 0 if nobody did
+	AverageRank float64 `json:"averageRank"`
+	Count       int     `json:"count"`
+}
+
+// rankLength returns how many options a participant ranks: the top Top
+// options, or all of them.
+func (slide Slide) rankLength() int {
+	if slide.Top > 0 && slide.Top < len(slide.Answers) {
+		return slide.Top
+	}
+	return len(slide.Answers)
+}
+
+// validateRanking checks that answers ranks exactly rankLength different
+// options of the slide, best first.
+func (slide Slide) validateRanking(answers []string) error {
+	if len(answers) != slide.rankLength() {
+		return fmt.Errorf("Rank %d options, not %d", slide.rankLength(), len(answers))
+	}
+
+	seen := make(map[string]bool)
+	for _, answer := range answers {
+		if seen[answer] {
+			return fmt.Errorf("%q is ranked more than once", answer)
+		}
+		seen[answer] = true
+
+		valid := false
+		for _, a := range slide.Answers {
+			if answer == a {
+				valid = true
+			}
+		}
+		if !valid {
+			return fmt.Errorf("%q is not an option", answer)
+		}
+	}
+	return nil
+}
+
+// summarizeRanking combines how often each option was ranked and the sum of
+// its positions into Borda points and average ranks, best option first.
+func summarizeRanking(slide Slide, counts, rankSums map[string]int) []RankingResult {
+	n := len(slide.Answers)
+	results := make([]RankingResult, 0, n)
+	for _, answer := range slide.Answers {
+		result := RankingResult{Answer: answer, Count: counts[answer]}
+		if result.Count > 0 {
+			// Position p earns n+1-p points
+			result.Points = result.Count*(n+1) - rankSums[answer]
+			result.AverageRank = roundTo(float64(rankSums[answer])/float64(result.Count), 2)
+		}
+		results = append(results, result)
+	}
+
+	// Ties keep the order of the config
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Points > results[j].Points
+	})
+	return results
+}
+
+// rankingResults returns the aggregate of a ranking slide.
+func (s *Session) rankingResults(slide int) []RankingResult {
+	st := s.tally.slide(slide)
+	return summarizeRanking(s.config().Survey[slide], st.snapshot(), st.rankSnapshot())
+}
+
+// rankingRows lists every option with its Borda points and average rank for
+// the CSV export.
+func rankingRows(results []RankingResult) [][]string {
+	rows := make([][]string, 0, len(results))
+	for _, result := range results {
+		rows = append(rows, []string{
+			result.Answer,
+			strconv.Itoa(result.Points),
+			strconv.FormatFloat(result.AverageRank, 'f', -1, 64),
+		})
+	}
+	return rows
+}
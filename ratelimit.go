@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RateLimit caps how many answers are taken per minute from one IP address
+// and from one participant. Zero leaves it open.
+type RateLimit struct {
+	PerIP   int `yaml:"perIP,omitempty"`
+	PerUser int `yaml:"perUser,omitempty"`
+}
+
+const (
+	rateWindow = time.Minute
+
+	// Presenter secrets may be tried this often per window from one IP
+	// address, as checking hashed secrets takes a while
+	secretAttemptsPerIP = 10
+
+	// Windows that ran out are swept once this many keys are tracked
+	rateSweepSize = 1024
+)
+
+type rateCount struct {
+	start time.Time
+	count int
+}
+
+// rateLimiter counts requests per key in fixed windows of rateWindow.
+type rateLimiter struct {
+	mu      sync.Mutex
+	windows map[string]rateCount
+}
+
+// allow counts a request for key and reports whether it is within limit.
+func (l *rateLimiter) allow(key string, limit int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.windows == nil {
+		l.windows = make(map[string]rateCount)
+	}
+
+	w := l.windows[key]
+	if now.Sub(w.start) >= rateWindow {
+		if len(l.windows) >= rateSweepSize {
+			for k, old := range l.windows {
+				if now.Sub(old.start) >= rateWindow {
+					delete(l.windows, k)
+				}
+			}
+		}
+		w = rateCount{start: now}
+	}
+	w.count++
+	l.windows[key] = w
+	return w.count <= limit
+}
+
+// secretAttempts counts the presenter secrets tried per IP address.
+var secretAttempts = &rateLimiter{}
+
+// allowSecretAttempt counts a presenter secret tried from ip and reports
+// whether it may be checked.
+func allowSecretAttempt(ip string) bool {
+	return secretAttempts.allow(ip, secretAttemptsPerIP, time.Now())
+}
+
+// ipExtractor returns how the client IP of a request is found, which the
+// rate limits count by. X-Forwarded-For is only believed from the proxies in
+// trusted, a comma separated list of CIDR ranges. Without any, the address
+// of the connection is used, so clients cannot pick their own IP.
+func ipExtractor(trusted string) (echo.IPExtractor, error) {
+	if trusted == "" {
+		return echo.ExtractIPDirect(), nil
+	}
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, cidr := range strings.Split(trusted, ",") {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
+// allowSubmit reports whether an answer, upvote or nickname from ip by userID
+// is within the rate limits of the survey.
+func (s *Session) allowSubmit(ip string, userID string) bool {
+	limit := s.config().RateLimit
+	now := time.Now()
+	if limit.PerIP > 0 && !s.submits.allow("ip:"+ip, limit.PerIP, now) {
+		return false
+	}
+	if limit.PerUser > 0 && !s.submits.allow("user:"+userID, limit.PerUser, now) {
+		return false
+	}
+	return true
+}
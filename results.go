@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// slideTally counts the answers given on one slide. Every option has its own
+// atomic counter, so concurrent submits never lose a vote and reading the
+// results does not re-count the raw responses kept in the store.
+type slideTally struct {
+	counts      sync.Map // answer -> *int64
+	ranks       sync.Map // answer -> *int64, sum of the positions it was ranked at
+	respondents int64
+}
+
+// add counts the answers of one respondent.
+func (t *slideTally) add(answers []string) {
+	t.addRespondent()
+	t.count(answers)
+}
+
+func (t *slideTally) addRespondent() {
+	atomic.AddInt64(&t.respondents, 1)
+}
+
+// count adds answers to the results without counting a respondent, for
+// moderated answers that are approved after they were submitted.
+func (t *slideTally) count(answers []string) {
+	for _, answer := range answers {
+		counter, _ := t.counts.LoadOrStore(answer, new(int64))
+		atomic.AddInt64(counter.(*int64), 1)
+	}
+}
+
+// addRanking counts the ordered answers of one respondent to a ranking slide.
+func (t *slideTally) addRanking(answers []string) {
+	t.add(answers)
+	for i, answer := range answers {
+		sum, _ := t.ranks.LoadOrStore(answer, new(int64))
+		atomic.AddInt64(sum.(*int64), int64(i+1))
+	}
+}
+
+func (t *slideTally) respondentCount() int {
+	return int(atomic.LoadInt64(&t.respondents))
+}
+
+func (t *slideTally) snapshot() map[string]int {
+	results := make(map[string]int)
+	t.counts.Range(func(key, value interface{}) bool {
+		results[key.(string)] = int(atomic.LoadInt64(value.(*int64)))
+		return true
+	})
+	return results
+}
+
+func (t *slideTally) rankSnapshot() map[string]int {
+	sums := make(map[string]int)
+	t.ranks.Range(func(key, value interface{}) bool {
+		sums[key.(string)] = int(atomic.LoadInt64(value.(*int64)))
+		return true
+	})
+	return sums
+}
+
+// tally holds the counters of every slide in a session.
+type tally struct {
+	slides sync.Map // slide -> *slideTally
+}
+
+func (t *tally) slide(slide int) *slideTally {
+	st, _ := t.slides.LoadOrStore(slide, &slideTally{})
+	return st.(*slideTally)
+}
+
+func (t *tally) reset() {
+	t.slides.Range(func(key, _ interface{}) bool {
+		t.slides.Delete(key)
+		return true
+	})
+}
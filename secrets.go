@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Highest costs accepted in a hashed secret. Anyone may upload a survey, and
+// every presenter login runs the hashes, so costlier hashes would let an
+// upload tie up the server.
+const (
+	maxBcryptCost    = bcrypt.DefaultCost
+	maxArgon2Memory  = 19 * 1024 // KiB
+	maxArgon2Time    = 2
+	maxArgon2Threads = 4
+	maxArgon2KeyLen  = 64
+)
+
+// argon2Hash is a parsed argon2id hash in the usual
+// "$argon2id$v=19$m=...,t=...,p=...$salt$key" form.
+type argon2Hash struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func isBcryptHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
+
+func isArgon2Hash(stored string) bool {
+	return strings.HasPrefix(stored, "$argon2id$")
+}
+
+// isHashedSecret reports whether a config holds a hash of its secret rather
+// than the secret itself.
+func isHashedSecret(stored string) bool {
+	return isBcryptHash(stored) || isArgon2Hash(stored)
+}
+
+// validateSecret rejects hashed secrets that cannot be read or cost more to
+// check than the server allows.
+func validateSecret(stored string) error {
+	switch {
+	case isBcryptHash(stored):
+		cost, err := bcrypt.Cost([]byte(stored))
+		if err != nil {
+			return errors.New("not a valid bcrypt hash")
+		}
+		if cost > maxBcryptCost {
+			return fmt.Errorf("bcrypt cost %d is above the limit of %d", cost, maxBcryptCost)
+		}
+	case isArgon2Hash(stored):
+		if _, err := parseArgon2(stored); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// secretMatches reports whether secret is the presenter secret of a config.
+// The config may hold the secret itself, a bcrypt hash ("$2a$...", "$2b$...")
+// or an argon2id hash. Every comparison takes constant time.
+func secretMatches(stored string, secret string) bool {
+	if stored == "" || secret == "" {
+		return false
+	}
+	// Hashes are checked again, as they may have been stored before the
+	// limits were in place
+	if validateSecret(stored) != nil {
+		return false
+	}
+	switch {
+	case isBcryptHash(stored):
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(secret)) == nil
+	case isArgon2Hash(stored):
+		return argon2Matches(stored, secret)
+	default:
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(secret)) == 1
+	}
+}
+
+// secretsCollide reports whether the stored secrets of two configs could be
+// the same secret. Two hashes only collide if they are the same hash, as
+// hashes with different salts cannot be compared.
+func secretsCollide(a string, b string) bool {
+	if subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1 {
+		return true
+	}
+	if !isHashedSecret(a) {
+		return secretMatches(b, a)
+	}
+	if !isHashedSecret(b) {
+		return secretMatches(a, b)
+	}
+	return false
+}
+
+var errArgon2Hash = errors.New("not a valid argon2id hash")
+
+func parseArgon2(stored string) (argon2Hash, error) {
+	var h argon2Hash
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 || parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return h, errArgon2Hash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return h, errArgon2Hash
+	}
+	if h.memory > maxArgon2Memory || h.time < 1 || h.time > maxArgon2Time || h.threads < 1 || h.threads > maxArgon2Threads {
+		return h, fmt.Errorf("argon2id cost m=%d,t=%d,p=%d is outside the limits of m=%d,t=%d,p=%d",
+			h.memory, h.time, h.threads, maxArgon2Memory, maxArgon2Time, maxArgon2Threads)
+	}
+
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return h, errArgon2Hash
+	}
+	h.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(h.key) == 0 || len(h.key) > maxArgon2KeyLen {
+		return h, errArgon2Hash
+	}
+	return h, nil
+}
+
+func argon2Matches(stored string, secret string) bool {
+	h, err := parseArgon2(stored)
+	if err != nil {
+		return false
+	}
+	derived := argon2.IDKey([]byte(secret), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+	return subtle.ConstantTimeCompare(derived, h.key) == 1
+}
+
+// hashSecret returns the bcrypt hash of a presenter secret for the config.
+func hashSecret(secret string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	return string(hash), err
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Surveys with this mode are answered at each participant's own pace instead
+// of following the presenter
+const selfPacedMode = "self-paced"
+
+// Progress is the aggregate progress of a self-paced survey, shown to the
+// presenter instead of the slide controls.
+type Progress struct {
+	Participants int `json:"participants"`
+	Completed    int `json:"completed"`
+	// Current is the number of participants on every slide, Answers the
+	// number of answers given on it
+	Current []int `json:"current"`
+	Answers []int `json:"answers"`
+}
+
+func (c Config) isSelfPaced() bool {
+	return c.Mode == selfPacedMode
+}
+
+// requireLive guards the slide controls of the presenter, as participants
+// move through a self-paced survey on their own. It goes after requireRole.
+func requireLive(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if controlledSession(c).config().isSelfPaced() {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Participants move through a self-paced survey on their own"})
+		}
+		return next(c)
+	}
+}
+
+// nextSlideFor returns the slide userID goes on to after slide in a
+// self-paced survey, or the number of slides past the last one. Leaderboard
+// slides are skipped as they only make sense live, and so are slides whose
+// showIf conditions do not hold for the participant.
+func (s *Session) nextSlideFor(userID string, slide int) int {
+	survey := s.config().Survey
+	for slide++; slide < len(survey); slide++ {
+		if survey[slide].Type != leaderboardSlideType && s.showsTo(slide, userID) {
+			break
+		}
+	}
+	return slide
+}
+
+// cursor returns the slide userID is on in a self-paced survey. Participants
+// start at the first slide.
+func (s *Session) cursor(userID string) int {
+	if slide, ok := s.cursors.Load(userID); ok {
+		return slide.(int)
+	}
+	slide := s.nextSlideFor(userID, -1)
+	s.setCursor(userID, slide)
+	return slide
+}
+
+// advanceCursor moves userID on from slide to the next slide. It returns the
+// slide the participant ends up on.
+func (s *Session) advanceCursor(userID string, slide int) int {
+	next := s.nextSlideFor(userID, slide)
+	s.setCursor(userID, next)
+	return next
+}
+
+func (s *Session) setCursor(userID string, slide int) {
+	s.cursors.Store(userID, slide)
+	if err := store.SaveCursor(s.config().Token, userID, slide); err != nil {
+		log.Printf("Error saving cursor: %v", err)
+	}
+	s.progressChanged()
+}
+
+// finished reports whether userID has gone through every slide of a
+// self-paced survey.
+func (s *Session) finished(userID string) bool {
+	slide, ok := s.cursors.Load(userID)
+	return ok && slide.(int) >= len(s.config().Survey)
+}
+
+// progressChanged marks the progress as stale. It is broadcast to the
+// presenter on the next tick of publishResults.
+func (s *Session) progressChanged() {
+	atomic.StoreInt32(&s.progressPending, 1)
+}
+
+func (s *Session) progress() Progress {
+	survey := s.config().Survey
+	p := Progress{
+		Current: make([]int, len(survey)),
+		Answers: make([]int, len(survey)),
+	}
+	s.cursors.Range(func(_, slide interface{}) bool {
+		p.Participants++
+		if slide.(int) >= len(survey) {
+			p.Completed++
+		} else {
+			p.Current[slide.(int)]++
+		}
+		return true
+	})
+	for i := range survey {
+		p.Answers[i] = s.tally.slide(i).respondentCount()
+	}
+	return p
+}
+
+// restoreCursors reloads the slide of every participant of a self-paced
+// survey from the store.
+func (s *Session) restoreCursors() {
+	cursors, err := store.Cursors(s.config().Token)
+	if err != nil {
+		log.Printf("Error loading cursors: %v", err)
+	}
+	for userID, slide := range cursors {
+		s.cursors.Store(userID, slide)
+	}
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Session is a single running survey. Every session has its own slide
+// pointer, answers, WebSocket audience and presenter secret, so several
+// presenters can share one server.
+type Session struct {
+	mu           sync.RWMutex
+	cfg          Config
+	currentSlide int32
+	hub          *Hub
+	tally        tally
+	lockedSlides sync.Map // slide -> true while voting is closed
+	timer        slideTimer
+	quiz         quizScores
+	qa           qaBoard
+	wordForms    sync.Map // "<slide>:<stem>" -> first word form counted
+	cursors      sync.Map // userID -> slide, in self-paced surveys
+	joined       sync.Map // userID -> true once the participant opened the survey
+	invites      sync.Map // invite code -> userID, once the code was used
+	invitees     sync.Map // userID -> invite code
+	submits      rateLimiter
+
+	// Serialises the automatic slide actions, so two triggers for the same
+	// slide cannot skip a slide
+	actionMu sync.Mutex
+
+	// Slides with answers that have not been broadcast yet
+	pendingMu      sync.Mutex
+	pendingResults map[int]bool
+	// Set when the Q&A board, the moderation queue, the progress of a
+	// self-paced survey or the used invite codes changed since the last
+	// broadcast
+	questionsPending  int32
+	moderationPending int32
+	progressPending   int32
+	invitesPending    int32
+}
+
+const (
+	defaultResultInterval = 250 * time.Millisecond
+	// Results are never pushed more often than this, as every push goes to
+	// every client
+	minResultInterval = 50 * time.Millisecond
+)
+
+const (
+	// Actions run when a timed slide runs out or everyone has answered
+	slideActionLock = "lock"
+	slideActionNext = "next"
+)
+
+// validateSlideAction rejects actions other than "lock" and "next". An empty
+// action is left to the caller.
+func validateSlideAction(action string) error {
+	if action != slideActionLock && action != slideActionNext {
+		return fmt.Errorf("%q is not %q or %q", action, slideActionLock, slideActionNext)
+	}
+	return nil
+}
+
+func newSession(cfg Config) *Session {
+	s := &Session{
+		cfg:            cfg,
+		currentSlide:   -1,
+		hub:            newHub(),
+		pendingResults: make(map[int]bool),
+	}
+	go s.hub.run()
+	go s.publishResults()
+	return s
+}
+
+func (s *Session) config() Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cfg
+}
+
+func (s *Session) slide() int {
+	return int(atomic.LoadInt32(&s.currentSlide))
+}
+
+func (s *Session) setSlide(slide int) {
+	atomic.StoreInt32(&s.currentSlide, int32(slide))
+	if err := store.SaveCurrentSlide(s.config().Token, slide); err != nil {
+		log.Printf("Error saving current slide: %v", err)
+	}
+}
+
+// goToSlide makes slide the active slide and moves the audience to it. It
+// reports false once the survey has run past its last slide. Answers already
+// given on a revisited slide are kept.
+func (s *Session) goToSlide(slide int) bool {
+	s.setSlide(slide)
+	s.startTimer(slide)
+	if slide >= len(s.config().Survey) {
+		s.hub.broadcast <- Message{Type: "finished", Payload: true}
+		return false
+	}
+
+	s.hub.broadcast <- Message{Type: "newSlide", Payload: slide}
+	s.hub.broadcast <- Message{Type: "votingLocked", Payload: s.votingLocked(slide)}
+	return true
+}
+
+// runSlideAction moves on to the next slide or closes voting, as configured
+// by action, as long as slide is still the active slide.
+func (s *Session) runSlideAction(slide int, action string) {
+	s.actionMu.Lock()
+	defer s.actionMu.Unlock()
+
+	if s.slide() != slide {
+		return
+	}
+	if action == slideActionNext {
+		s.goToSlide(slide + 1)
+	} else if !s.votingLocked(slide) {
+		s.setVotingLocked(true)
+	}
+}
+
+// checkAllAnswered runs the whenAllAnswered action of the survey once the
+// number of answers on slide reaches the number of connected participants
+// the slide is shown to.
+func (s *Session) checkAllAnswered(slide int) {
+	action := s.config().WhenAllAnswered
+	if action == "" {
+		return
+	}
+
+	participants := 0
+	for _, userID := range s.hub.participantIDs() {
+		if s.showsTo(slide, userID) {
+			participants++
+		}
+	}
+	if participants > 0 && s.tally.slide(slide).respondentCount() >= participants {
+		s.runSlideAction(slide, action)
+	}
+}
+
+// votingLocked reports whether the presenter has closed voting on slide.
+func (s *Session) votingLocked(slide int) bool {
+	_, locked := s.lockedSlides.Load(slide)
+	return locked
+}
+
+// setVotingLocked opens or closes voting on the active slide and tells the
+// audience about it.
+func (s *Session) setVotingLocked(locked bool) {
+	slide := s.slide()
+	if locked {
+		s.lockedSlides.Store(slide, true)
+		s.stopTimer()
+	} else {
+		s.lockedSlides.Delete(slide)
+	}
+	if err := store.SetSlideLocked(s.config().Token, slide, locked); err != nil {
+		log.Printf("Error saving voting lock: %v", err)
+	}
+	s.hub.broadcast <- Message{Type: "votingLocked", Payload: locked}
+}
+
+// resultsChanged marks the results of slide as stale. They are broadcast on
+// the next tick of publishResults, so a burst of answers causes one update.
+func (s *Session) resultsChanged(slide int) {
+	s.pendingMu.Lock()
+	s.pendingResults[slide] = true
+	s.pendingMu.Unlock()
+}
+
+// publishResults sends the latest aggregate of the current slide once per
+// result interval, and only if new answers arrived since the last tick. The
+// Q&A board and the moderation queue are throttled the same way.
+func (s *Session) publishResults() {
+	for {
+		interval := s.config().ResultInterval
+		if interval < minResultInterval {
+			interval = defaultResultInterval
+		}
+		time.Sleep(interval)
+
+		s.pendingMu.Lock()
+		pending := s.pendingResults
+		s.pendingResults = make(map[int]bool)
+		s.pendingMu.Unlock()
+
+		if atomic.SwapInt32(&s.questionsPending, 0) == 1 {
+			s.publishQuestions()
+		}
+		if atomic.SwapInt32(&s.moderationPending, 0) == 1 {
+			s.hub.broadcast <- Message{Type: "moderationQueue", Payload: s.pendingModeration(), presenterOnly: true}
+		}
+		if atomic.SwapInt32(&s.progressPending, 0) == 1 && s.config().isSelfPaced() {
+			s.hub.broadcast <- Message{Type: "progress", Payload: s.progress(), presenterOnly: true}
+		}
+		if atomic.SwapInt32(&s.invitesPending, 0) == 1 && s.config().isInviteOnly() {
+			s.hub.broadcast <- Message{Type: "invites", Payload: s.inviteStatus(), presenterOnly: true}
+		}
+
+		if len(pending) > 0 && s.config().isQuiz() {
+			s.hub.broadcast <- Message{Type: "leaderboard", Payload: s.topLeaderboard()}
+		}
+
+		slide := s.slide()
+		if !pending[slide] {
+			continue
+		}
+		results := s.getResults(slide)
+		s.hub.broadcast <- Message{Type: "newAnswer", Payload: results}
+		if survey := s.config().Survey; slide >= 0 && slide < len(survey) && survey[slide].isNumeric() {
+			s.hub.broadcast <- Message{Type: "scaleSummary", Payload: summarizeScale(survey[slide], results)}
+		} else if slide >= 0 && slide < len(survey) && survey[slide].Type == rankingSlideType {
+			s.hub.broadcast <- Message{Type: "ranking", Payload: s.rankingResults(slide)}
+		} else if slide >= 0 && slide < len(survey) && survey[slide].Type == matrixSlideType {
+			s.hub.broadcast <- Message{Type: "matrix", Payload: summarizeMatrix(survey[slide], results)}
+		}
+	}
+}
+
+// reset sends the audience back to the start page and clears every answer
+// before the session starts over with cfg.
+func (s *Session) reset(cfg Config) {
+	s.hub.broadcast <- Message{Type: "shutdown", Payload: "Server is restarting"}
+
+	// Wait for a short period to allow clients to disconnect
+	time.Sleep(1 * time.Second)
+
+	s.stopTimer()
+
+	if err := s.clearAnswers(); err != nil {
+		log.Printf("Error resetting store: %v", err)
+	}
+
+	s.mu.Lock()
+	s.cfg = cfg
+	s.mu.Unlock()
+
+	atomic.StoreInt32(&s.currentSlide, -1)
+}
+
+// hasAnswers reports whether anyone answered a slide of the survey.
+func (s *Session) hasAnswers() bool {
+	for i := range s.config().Survey {
+		if s.tally.slide(i).respondentCount() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// clearAnswers forgets every answer, score, question, participant cursor and
+// voting lock of the session.
+func (s *Session) clearAnswers() error {
+	err := store.Reset(s.config().Token)
+	s.tally.reset()
+	s.wordForms.Range(func(key, _ interface{}) bool {
+		s.wordForms.Delete(key)
+		return true
+	})
+	s.quiz.reset()
+	s.qa.reset()
+	s.cursors.Range(func(key, _ interface{}) bool {
+		s.cursors.Delete(key)
+		return true
+	})
+	s.joined.Range(func(key, _ interface{}) bool {
+		s.joined.Delete(key)
+		return true
+	})
+	s.invites.Range(func(key, _ interface{}) bool {
+		s.invites.Delete(key)
+		return true
+	})
+	s.invitees.Range(func(key, _ interface{}) bool {
+		s.invitees.Delete(key)
+		return true
+	})
+	s.progressChanged()
+	s.invitesChanged()
+	s.questionsChanged()
+	s.moderationChanged()
+	s.lockedSlides.Range(func(key, _ interface{}) bool {
+		s.lockedSlides.Delete(key)
+		return true
+	})
+	return err
+}
+
+// sessionRegistry holds every running session keyed by participant token.
+type sessionRegistry struct {
+	mu      sync.RWMutex
+	byToken map[string]*Session
+	// Tokens that were rotated out, for participants who joined before
+	retired map[string]*Session
+}
+
+var sessions = &sessionRegistry{
+	byToken: make(map[string]*Session),
+	retired: make(map[string]*Session),
+}
+
+func (r *sessionRegistry) get(token string) (*Session, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.byToken[token]
+	return s, ok
+}
+
+// list returns every running session.
+func (r *sessionRegistry) list() []*Session {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]*Session, 0, len(r.byToken))
+	for _, s := range r.byToken {
+		list = append(list, s)
+	}
+	return list
+}
+
+// bySecret finds the session a presenter secret belongs to. A secret that
+// opens more than one session opens none, as it would be a guess which one
+// the presenter meant. Hashed secrets are checked outside the registry lock,
+// as they take a while.
+func (r *sessionRegistry) bySecret(secret string) (*Session, bool) {
+	if secret == "" {
+		return nil, false
+	}
+	var found *Session
+	for _, s := range r.list() {
+		if !secretMatches(s.config().Secret, secret) {
+			continue
+		}
+		if found != nil {
+			log.Printf("Rejected a presenter secret that matches more than one survey")
+			return nil, false
+		}
+		found = s
+	}
+	return found, found != nil
+}
+
+// secretTaken reports whether the stored secret of a config could be the
+// secret of a session other than the one with token.
+func (r *sessionRegistry) secretTaken(stored string, token string) bool {
+	for _, s := range r.list() {
+		if s.config().Token != token && secretsCollide(s.config().Secret, stored) {
+			return true
+		}
+	}
+	return false
+}
+
+// byRetiredToken finds the session a rotated out token belonged to.
+func (r *sessionRegistry) byRetiredToken(token string) (*Session, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.retired[token]
+	return s, ok
+}
+
+// inUse reports whether token is or was the token of a session.
+func (r *sessionRegistry) inUse(token string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, current := r.byToken[token]
+	_, retired := r.retired[token]
+	return current || retired
+}
+
+// retire moves s from its old token to its current one.
+func (r *sessionRegistry) retire(s *Session, oldToken string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.byToken, oldToken)
+	r.retired[oldToken] = s
+	r.byToken[s.config().Token] = s
+}
+
+func (r *sessionRegistry) add(s *Session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byToken[s.config().Token] = s
+}
+
+func (r *sessionRegistry) count() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.byToken)
+}
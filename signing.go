@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"strings"
+)
+
+// signingKey signs the cookies the server hands out. It comes from
+// OPENSURVEY_KEY, or is generated once and kept in the store, so cookies stay
+// valid across restarts.
+var signingKey []byte
+
+func loadSigningKey() error {
+	if key := os.Getenv("OPENSURVEY_KEY"); key != "" {
+		signingKey = []byte(key)
+		return nil
+	}
+	key, err := store.SigningKey()
+	if err != nil {
+		return err
+	}
+	signingKey = key
+	return nil
+}
+
+// signValue appends an HMAC of value, so the server can tell the values it
+// issued from forged ones.
+func signValue(value string) string {
+	return value + "." + signature(value)
+}
+
+// verifyValue returns the value of signed if its signature is valid.
+func verifyValue(signed string) (string, bool) {
+	i := strings.LastIndexByte(signed, '.')
+	if i < 0 {
+		return "", false
+	}
+	value := signed[:i]
+	if !hmac.Equal([]byte(signed[i+1:]), []byte(signature(value))) {
+		return "", false
+	}
+	return value, true
+}
+
+func signature(value string) string {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
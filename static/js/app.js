@@ -54,7 +54,7 @@
 
     function connectWebSocket() {
         const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-        socket = new WebSocket(`${protocol}//${window.location.host}/ws`);
+        socket = new WebSocket(`${protocol}//${window.location.host}/ws?token=${encodeURIComponent(token)}`);
 
         socket.onmessage = function (event) {
             const message = JSON.parse(event.data);
@@ -76,6 +76,20 @@
             } else if (message.type === "userCount") {
                 // Update the user count in the appState
                 window.appState.setState('userCount', message.payload);
+            } else if (message.type === "questions") {
+                window.appState.setState('questions', message.payload);
+            } else if (message.type === "matrix") {
+                window.appState.setState('matrix', message.payload);
+            } else if (message.type === "ranking") {
+                window.appState.setState('ranking', message.payload);
+            } else if (message.type === "scaleSummary") {
+                window.appState.setState('scaleSummary', message.payload);
+            } else if (message.type === "leaderboard") {
+                window.appState.setState('leaderboard', message.payload);
+            } else if (message.type === "timer") {
+                window.appState.setState('timer', message.payload);
+            } else if (message.type === "votingLocked") {
+                window.appState.setState('votingLocked', message.payload);
             } else if (message.type === "finished") {
                 window.location.href = `/completed/${token}`;
             } else if (message.type === "emoji") {
@@ -88,6 +102,11 @@
                 if (emojiToRemove) {
                     explodeEmoji(emojiToRemove);
                 }
+            } else if (message.type === "tokenChanged") {
+                // The presenter rotated the token, follow it to the new one
+                const pathParts = window.location.pathname.split('/');
+                pathParts[pathParts.length - 1] = encodeURIComponent(message.payload);
+                window.location.href = pathParts.join('/');
             } else if (message.type === "shutdown") {
                 window.location.href = "/"
             }
@@ -100,8 +119,12 @@
     }
 
     function redirectToCorrectSlide() {
-        if (window.location.pathname.indexOf("results") > 0) {
-            // Redirect to the survey
+        if (window.location.pathname.indexOf("/questions/") === 0) {
+            // The Q&A board stays open while the slides move on
+            return;
+        }
+        if (window.location.pathname.indexOf("/survey/") !== 0) {
+            // Redirect to the survey from the results or completed page
             window.location.href = `/survey/${token}`;
         } else {
             // Reload the survey page
@@ -109,7 +132,10 @@
         }
     }
 
-    connectWebSocket();
+    // Only pages below /survey, /results and /completed belong to a session
+    if (token) {
+        connectWebSocket();
+    }
 
     // Function to update results in the DOM when appState changes
     function updateResults(results) {
@@ -146,12 +172,118 @@
         }
     }
 
+    // Show or hide the voting closed notice, the survey page is rendered
+    // again so the form appears or disappears
+    function updateVotingLocked(locked) {
+        const surveyForm = document.querySelector('form.survey');
+        const closedNotice = document.querySelector('.voting-closed');
+        const onQuestion = window.location.pathname.indexOf("/survey/") === 0 && (surveyForm || closedNotice);
+        if (onQuestion && locked === !!surveyForm) {
+            window.location.reload();
+        } else if (closedNotice) {
+            closedNotice.classList.toggle('hidden', !locked);
+        }
+    }
+
+    // Update the statistics of scale and NPS slides
+    function updateScaleSummary(summary) {
+        document.querySelectorAll('#scale-summary [data-stat]').forEach(element => {
+            const value = element.getAttribute('data-stat').split('.')
+                .reduce((obj, key) => (obj === undefined ? undefined : obj[key]), summary);
+            if (value !== undefined) {
+                element.textContent = value;
+            }
+        });
+    }
+
+    // Redraw the Q&A board, keeping the upvotes of this participant
+    function updateQuestions(questions) {
+        const list = document.getElementById('questions-list');
+        if (!list) return;
+
+        const upvoted = new Set(Array.from(list.querySelectorAll('.question[data-upvoted="true"]'))
+            .map(element => element.getAttribute('data-id')));
+        list.innerHTML = '';
+        questions.forEach(question => {
+            const li = document.createElement('li');
+            li.className = 'question' + (question.answered ? ' answered' : '');
+            li.setAttribute('data-id', question.id);
+            li.setAttribute('data-upvoted', upvoted.has(question.id));
+
+            const form = document.createElement('form');
+            form.method = 'post';
+            form.action = `/questions/${token}/${question.id}/upvote`;
+            const button = document.createElement('button');
+            button.type = 'submit';
+            button.className = 'upvote';
+            button.disabled = upvoted.has(question.id);
+            button.textContent = `▲ ${question.votes}`;
+            form.appendChild(button);
+
+            const text = document.createElement('span');
+            text.className = 'question-text';
+            text.textContent = question.text;
+
+            li.appendChild(form);
+            li.appendChild(text);
+            if (question.answered) {
+                const badge = document.createElement('span');
+                badge.className = 'question-answered';
+                badge.textContent = 'Answered';
+                li.appendChild(badge);
+            }
+            list.appendChild(li);
+        });
+    }
+
+    // Redraw the quiz standings when scores change
+    function updateLeaderboard(entries) {
+        const leaderboard = document.getElementById('leaderboard');
+        if (!leaderboard) return;
+
+        leaderboard.innerHTML = '';
+        entries.forEach(entry => {
+            const li = document.createElement('li');
+            li.className = 'leaderboard-entry';
+            [['leaderboard-rank', entry.rank], ['leaderboard-nickname', entry.nickname], ['leaderboard-score', entry.score]]
+                .forEach(([className, text]) => {
+                    const span = document.createElement('span');
+                    span.className = className;
+                    span.textContent = text;
+                    li.appendChild(span);
+                });
+            leaderboard.appendChild(li);
+        });
+    }
+
+    // Show the seconds left on the countdown of the active slide
+    function updateTimer(remaining) {
+        const timerElement = document.getElementById('timer');
+        if (!timerElement) return;
+
+        const minutes = Math.floor(remaining / 60);
+        const seconds = String(remaining % 60).padStart(2, '0');
+        timerElement.textContent = `${minutes}:${seconds}`;
+        timerElement.classList.remove('hidden');
+        timerElement.classList.toggle('expiring', remaining <= 5);
+    }
+
     // Subscribe to state changes
     window.appState.subscribe((key, value) => {
         if (key === 'results') {
             updateResults(value);
         } else if (key === 'userCount') {
             updateUserCount(value);
+        } else if (key === 'votingLocked') {
+            updateVotingLocked(value);
+        } else if (key === 'timer') {
+            updateTimer(value);
+        } else if (key === 'leaderboard') {
+            updateLeaderboard(value);
+        } else if (key === 'scaleSummary') {
+            updateScaleSummary(value);
+        } else if (key === 'questions') {
+            updateQuestions(value);
         }
     });
 
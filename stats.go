@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+const (
+	scaleSlideType = "scale"
+	npsSlideType   = "nps"
+
+	// Most values a scale may offer, so the slide and its results stay
+	// readable
+	maxScaleValues = 101
+)
+
+// isNumeric reports whether the slide takes a number on a scale.
+func (slide Slide) isNumeric() bool {
+	return slide.Type == scaleSlideType || slide.Type == npsSlideType
+}
+
+// scaleBounds returns the lowest value, highest value and step of a numeric
+// slide. NPS slides always run from 0 to 10, scales default to 1 to 5.
+func (slide Slide) scaleBounds() (float64, float64, float64) {
+	if slide.Type == npsSlideType {
+		return 0, 10, 1
+	}
+	low, high, step := slide.Min, slide.Max, slide.Step
+	if low == 0 && high == 0 {
+		low, high = 1, 5
+	}
+	if step <= 0 {
+		step = 1
+	}
+	return low, high, step
+}
+
+// validateScale rejects scales that run backwards or offer more values than
+// fit on a slide.
+func (slide Slide) validateScale() error {
+	if slide.Type != scaleSlideType {
+		return nil
+	}
+	for _, v := range []float64{slide.Min, slide.Max, slide.Step} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return errors.New("min, max and step must be numbers")
+		}
+	}
+	if slide.Step < 0 {
+		return errors.New("step must be above 0")
+	}
+	low, high, step := slide.scaleBounds()
+	if high <= low {
+		return fmt.Errorf("max %s must be above min %s", formatScaleValue(high), formatScaleValue(low))
+	}
+	if math.Floor((high-low)/step+1e-6)+1 > maxScaleValues {
+		return fmt.Errorf("scale has more than %d values", maxScaleValues)
+	}
+	return nil
+}
+
+// scaleLabels returns the labels shown at the low and high end of the scale.
+func (slide Slide) scaleLabels() (string, string) {
+	if slide.Type == npsSlideType && slide.MinLabel == "" && slide.MaxLabel == "" {
+		return "Not at all likely", "Extremely likely"
+	}
+	return slide.MinLabel, slide.MaxLabel
+}
+
+// scaleValues lists every value that can be picked on a numeric slide.
+func (slide Slide) scaleValues() []string {
+	low, high, step := slide.scaleBounds()
+	var values []string
+	for i := 0; ; i++ {
+		v := low + float64(i)*step
+		if v > high+step/1e6 {
+			break
+		}
+		values = append(values, formatScaleValue(v))
+	}
+	return values
+}
+
+// parseScaleValue checks that answer is a number on the scale of the slide
+// and returns it in canonical form, so "7", "7.0" and " 7" count as one.
+func (slide Slide) parseScaleValue(answer string) (string, error) {
+	v, err := strconv.ParseFloat(answer, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return "", fmt.Errorf("%q is not a number", answer)
+	}
+
+	low, high, step := slide.scaleBounds()
+	if v < low || v > high {
+		return "", fmt.Errorf("%s is outside %s to %s", answer, formatScaleValue(low), formatScaleValue(high))
+	}
+	steps := (v - low) / step
+	if math.Abs(steps-math.Round(steps)) > 1e-6 {
+		return "", fmt.Errorf("%s is not a step of %s", answer, formatScaleValue(step))
+	}
+	return formatScaleValue(low + math.Round(steps)*step), nil
+}
+
+func formatScaleValue(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1e6)/1e6, 'f', -1, 64)
+}
+
+// ScaleSummary describes the answers to a numeric slide.
+type ScaleSummary struct {
+	Count  int         `json:"count"`
+	Mean   float64     `json:"mean"`
+	Median float64     `json:"median"`
+	StdDev float64     `json:"stdDev"`
+	NPS    *NPSSummary `json:"nps,omitempty"`
+}
+
+// NPSSummary splits NPS answers into promoters (9-10), passives (7-8) and
+// detractors (0-6). Score is the percentage of promoters minus the
+// percentage of detractors.
+type NPSSummary struct {
+	Promoters  int     `json:"promoters"`
+	Passives   int     `json:"passives"`
+	Detractors int     `json:"detractors"`
+	Score      float64 `json:"score"`
+}
+
+// summarizeScale computes the statistics of a numeric slide from its counts.
+func summarizeScale(slide Slide, results map[string]int) ScaleSummary {
+	type bucket struct {
+		value float64
+		count int
+	}
+	var buckets []bucket
+	summary := ScaleSummary{}
+	sum := 0.0
+	for answer, count := range results {
+		v, err := strconv.ParseFloat(answer, 64)
+		if err != nil || count <= 0 {
+			continue
+		}
+		buckets = append(buckets, bucket{v, count})
+		summary.Count += count
+		sum += v * float64(count)
+	}
+	if summary.Count == 0 {
+		return summary
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].value < buckets[j].value })
+
+	summary.Mean = sum / float64(summary.Count)
+
+	// The median is the middle answer, or the mean of the two middle answers
+	valueAt := func(n int) float64 {
+		for _, b := range buckets {
+			if n < b.count {
+				return b.value
+			}
+			n -= b.count
+		}
+		return buckets[len(buckets)-1].value
+	}
+	if summary.Count%2 == 1 {
+		summary.Median = valueAt(summary.Count / 2)
+	} else {
+		summary.Median = (valueAt(summary.Count/2-1) + valueAt(summary.Count/2)) / 2
+	}
+
+	variance := 0.0
+	for _, b := range buckets {
+		variance += float64(b.count) * (b.value - summary.Mean) * (b.value - summary.Mean)
+	}
+	summary.StdDev = math.Sqrt(variance / float64(summary.Count))
+
+	if slide.Type == npsSlideType {
+		nps := &NPSSummary{}
+		for _, b := range buckets {
+			switch {
+			case b.value >= 9:
+				nps.Promoters += b.count
+			case b.value >= 7:
+				nps.Passives += b.count
+			default:
+				nps.Detractors += b.count
+			}
+		}
+		nps.Score = float64(nps.Promoters-nps.Detractors) * 100 / float64(summary.Count)
+		summary.NPS = nps
+	}
+
+	summary.Mean = roundTo(summary.Mean, 2)
+	summary.StdDev = roundTo(summary.StdDev, 2)
+	if summary.NPS != nil {
+		summary.NPS.Score = roundTo(summary.NPS.Score, 1)
+	}
+	return summary
+}
+
+// scaleSummaryRows lists the statistics of a numeric slide as name and value
+// pairs for the CSV export.
+func scaleSummaryRows(summary ScaleSummary) [][]string {
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	rows := [][]string{
+		{"Mean", format(summary.Mean)},
+		{"Median", format(summary.Median)},
+		{"Standard deviation", format(summary.StdDev)},
+	}
+	if summary.NPS != nil {
+		rows = append(rows,
+			[]string{"Promoters", strconv.Itoa(summary.NPS.Promoters)},
+			[]string{"Passives", strconv.Itoa(summary.NPS.Passives)},
+			[]string{"Detractors", strconv.Itoa(summary.NPS.Detractors)},
+			[]string{"NPS", format(summary.NPS.Score)},
+		)
+	}
+	return rows
+}
+
+func roundTo(v float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(v*p) / p
+}
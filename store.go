@@ -0,0 +1,847 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/yaml.v2"
+)
+
+// Store persists the survey state so a restart of the server is invisible to
+// participants. Answers are kept per user so the raw responses survive as well.
+type Store interface {
+	SaveConfig(cfg Config) error
+	LoadConfigs() ([]Config, error)
+	SaveCurrentSlide(token string, slide int) error
+	CurrentSlide(token string) (int, bool, error)
+	SaveAnswers(token string, slide int, userID string, answers []string) (bool, error)
+	Responses(token string, slide int) (map[string][]string, error)
+	HasAnswered(token string, slide int, userID string) (bool, error)
+	Answers(token string, slide int, userID string) ([]string, error)
+	SetSlideLocked(token string, slide int, locked bool) error
+	LockedSlides(token string) ([]int, error)
+	SaveScore(token string, slide int, userID string, points int) error
+	Scores(token string) (map[string]int, error)
+	SaveNickname(token string, userID string, nickname string) error
+	Nicknames(token string) (map[string]string, error)
+	SaveQuestion(token string, q Question) error
+	Questions(token string) ([]Question, error)
+	SaveUpvote(token string, questionID string, userID string) (bool, error)
+	Upvoted(token string, userID string) (map[string]bool, error)
+	SaveModerationItem(token string, item ModerationItem) error
+	ModerationItems(token string) ([]ModerationItem, error)
+	Moderate(token string, id string, status string, text string) (ModerationItem, bool, error)
+	SaveCursor(token string, userID string, slide int) error
+	Cursors(token string) (map[string]int, error)
+	SigningKey() ([]byte, error)
+	SavePresenterLogin(id string, login PresenterLogin) error
+	PresenterLogin(id string) (PresenterLogin, bool, error)
+	DeletePresenterLogin(id string) error
+	DeletePresenterLogins(token string) error
+	SaveParticipant(token string, userID string) error
+	Participants(token string) ([]string, error)
+	SaveInvite(token string, code string, userID string) error
+	Invites(token string) (map[string]string, error)
+	RenameToken(oldToken string, newToken string) error
+	RetiredTokens() (map[string]string, error)
+	Reset(token string) error
+	Close() error
+}
+
+var (
+	stateBucket        = []byte("state")
+	answersBucket      = []byte("answers")
+	scoresBucket       = []byte("scores")
+	nicknamesBucket    = []byte("nicknames")
+	questionsBucket    = []byte("questions")
+	upvotesBucket      = []byte("upvotes")
+	moderationBucket   = []byte("moderation")
+	cursorsBucket      = []byte("cursors")
+	loginsBucket       = []byte("logins")
+	participantsBucket = []byte("participants")
+	invitesBucket      = []byte("invites")
+	configPrefix       = []byte("config:")
+	signingKeyKey      = []byte("signingKey")
+	retiredPrefix      = []byte("retired:")
+)
+
+type boltStore struct {
+	db *bolt.DB
+}
+
+func openBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{stateBucket, answersBucket, scoresBucket, nicknamesBucket, questionsBucket, upvotesBucket, moderationBucket, cursorsBucket, loginsBucket, participantsBucket, invitesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &boltStore{db: db}, nil
+}
+
+func slideKey(token string, slide int) []byte {
+	return []byte(fmt.Sprintf("%s:%d", token, slide))
+}
+
+func configKey(token string) []byte {
+	return append(append([]byte(nil), configPrefix...), token...)
+}
+
+func currentSlideKey(token string) []byte {
+	return []byte("slide:" + token)
+}
+
+func lockedPrefix(token string) []byte {
+	return []byte("locked:" + token + ":")
+}
+
+func (s *boltStore) SaveConfig(cfg Config) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(stateBucket).Put(configKey(cfg.Token), data)
+	})
+}
+
+func (s *boltStore) LoadConfigs() ([]Config, error) {
+	var configs []Config
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(stateBucket).Cursor()
+		for k, v := c.Seek(configPrefix); k != nil && bytes.HasPrefix(k, configPrefix); k, v = c.Next() {
+			var cfg Config
+			if err := yaml.Unmarshal(v, &cfg); err != nil {
+				return err
+			}
+			configs = append(configs, cfg)
+		}
+		return nil
+	})
+	return configs, err
+}
+
+func (s *boltStore) SaveCurrentSlide(token string, slide int) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(stateBucket).Put(currentSlideKey(token), []byte(strconv.Itoa(slide)))
+	})
+}
+
+func (s *boltStore) CurrentSlide(token string) (int, bool, error) {
+	slide := -1
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(stateBucket).Get(currentSlideKey(token))
+		if data == nil {
+			return nil
+		}
+		n, err := strconv.Atoi(string(data))
+		if err != nil {
+			return err
+		}
+		slide = n
+		found = true
+		return nil
+	})
+	return slide, found, err
+}
+
+// SaveAnswers appends the answers of userID to the response log. It reports
+// false and keeps the first response if the user already answered the slide.
+func (s *boltStore) SaveAnswers(token string, slide int, userID string, answers []string) (bool, error) {
+	data, err := json.Marshal(answers)
+	if err != nil {
+		return false, err
+	}
+	saved := false
+	// Batch lets bursts of concurrent submits share a single disk sync
+	err = s.db.Batch(func(tx *bolt.Tx) error {
+		saved = false
+		b, err := tx.Bucket(answersBucket).CreateBucketIfNotExists(slideKey(token, slide))
+		if err != nil {
+			return err
+		}
+		if b.Get([]byte(userID)) != nil {
+			return nil
+		}
+		saved = true
+		return b.Put([]byte(userID), data)
+	})
+	return saved, err
+}
+
+// Responses returns the answers given on slide keyed by user ID.
+func (s *boltStore) Responses(token string, slide int) (map[string][]string, error) {
+	responses := make(map[string][]string)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(answersBucket).Bucket(slideKey(token, slide))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var userAnswers []string
+			if err := json.Unmarshal(v, &userAnswers); err != nil {
+				return err
+			}
+			responses[string(k)] = userAnswers
+			return nil
+		})
+	})
+	return responses, err
+}
+
+func (s *boltStore) HasAnswered(token string, slide int, userID string) (bool, error) {
+	answered := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(answersBucket).Bucket(slideKey(token, slide))
+		answered = b != nil && b.Get([]byte(userID)) != nil
+		return nil
+	})
+	return answered, err
+}
+
+// Answers returns the answers userID gave on slide, or nil if the user has
+// not answered it.
+func (s *boltStore) Answers(token string, slide int, userID string) ([]string, error) {
+	var answers []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(answersBucket).Bucket(slideKey(token, slide))
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(userID))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &answers)
+	})
+	return answers, err
+}
+
+func (s *boltStore) SetSlideLocked(token string, slide int, locked bool) error {
+	key := append(lockedPrefix(token), strconv.Itoa(slide)...)
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if locked {
+			return tx.Bucket(stateBucket).Put(key, []byte{1})
+		}
+		return tx.Bucket(stateBucket).Delete(key)
+	})
+}
+
+func (s *boltStore) LockedSlides(token string) ([]int, error) {
+	var slides []int
+	prefix := lockedPrefix(token)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(stateBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			slide, err := strconv.Atoi(string(k[len(prefix):]))
+			if err != nil {
+				return err
+			}
+			slides = append(slides, slide)
+		}
+		return nil
+	})
+	return slides, err
+}
+
+// SaveScore records the points userID earned on slide.
+func (s *boltStore) SaveScore(token string, slide int, userID string, points int) error {
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(scoresBucket).CreateBucketIfNotExists([]byte(token))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(fmt.Sprintf("%d:%s", slide, userID)), []byte(strconv.Itoa(points)))
+	})
+}
+
+// Scores returns the total points of every user who scored in token.
+func (s *boltStore) Scores(token string) (map[string]int, error) {
+	scores := make(map[string]int)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(scoresBucket).Bucket([]byte(token))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			_, userID, found := strings.Cut(string(k), ":")
+			if !found {
+				return fmt.Errorf("invalid score key %q", k)
+			}
+			points, err := strconv.Atoi(string(v))
+			if err != nil {
+				return err
+			}
+			scores[userID] += points
+			return nil
+		})
+	})
+	return scores, err
+}
+
+func (s *boltStore) SaveNickname(token string, userID string, nickname string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(nicknamesBucket).CreateBucketIfNotExists([]byte(token))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(userID), []byte(nickname))
+	})
+}
+
+func (s *boltStore) Nicknames(token string) (map[string]string, error) {
+	nicknames := make(map[string]string)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(nicknamesBucket).Bucket([]byte(token))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			nicknames[string(k)] = string(v)
+			return nil
+		})
+	})
+	return nicknames, err
+}
+
+// SaveQuestion stores q on the Q&A board of token, replacing an earlier
+// version. The votes are counted from the upvotes instead.
+func (s *boltStore) SaveQuestion(token string, q Question) error {
+	q.Votes = 0
+	data, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(questionsBucket).CreateBucketIfNotExists([]byte(token))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(q.ID), data)
+	})
+}
+
+// Questions returns the Q&A board of token with the votes of every question.
+func (s *boltStore) Questions(token string) ([]Question, error) {
+	var questions []Question
+	err := s.db.View(func(tx *bolt.Tx) error {
+		votes := make(map[string]int)
+		if b := tx.Bucket(upvotesBucket).Bucket([]byte(token)); b != nil {
+			err := b.ForEach(func(k, _ []byte) error {
+				_, id, found := strings.Cut(string(k), ":")
+				if !found {
+					return fmt.Errorf("invalid upvote key %q", k)
+				}
+				votes[id]++
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		b := tx.Bucket(questionsBucket).Bucket([]byte(token))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			var q Question
+			if err := json.Unmarshal(v, &q); err != nil {
+				return err
+			}
+			q.Votes = votes[q.ID]
+			questions = append(questions, q)
+			return nil
+		})
+	})
+	return questions, err
+}
+
+func upvoteKey(userID string, questionID string) []byte {
+	return []byte(userID + ":" + questionID)
+}
+
+// SaveUpvote records the vote of userID for a question. It reports false if
+// the user had already voted for it.
+func (s *boltStore) SaveUpvote(token string, questionID string, userID string) (bool, error) {
+	saved := false
+	err := s.db.Batch(func(tx *bolt.Tx) error {
+		saved = false
+		b, err := tx.Bucket(upvotesBucket).CreateBucketIfNotExists([]byte(token))
+		if err != nil {
+			return err
+		}
+		key := upvoteKey(userID, questionID)
+		if b.Get(key) != nil {
+			return nil
+		}
+		saved = true
+		return b.Put(key, []byte{})
+	})
+	return saved, err
+}
+
+// Upvoted returns the IDs of the questions userID voted for.
+func (s *boltStore) Upvoted(token string, userID string) (map[string]bool, error) {
+	upvoted := make(map[string]bool)
+	prefix := upvoteKey(userID, "")
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(upvotesBucket).Bucket([]byte(token))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			upvoted[string(k[len(prefix):])] = true
+		}
+		return nil
+	})
+	return upvoted, err
+}
+
+func (s *boltStore) SaveModerationItem(token string, item ModerationItem) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(moderationBucket).CreateBucketIfNotExists([]byte(token))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(item.ID), data)
+	})
+}
+
+// ModerationItems returns every moderated answer of token, oldest first.
+func (s *boltStore) ModerationItems(token string) ([]ModerationItem, error) {
+	var items []ModerationItem
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(moderationBucket).Bucket([]byte(token))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			var item ModerationItem
+			if err := json.Unmarshal(v, &item); err != nil {
+				return err
+			}
+			items = append(items, item)
+			return nil
+		})
+	})
+	sort.Slice(items, func(i, j int) bool { return items[i].Submitted.Before(items[j].Submitted) })
+	return items, err
+}
+
+// Moderate sets the status of a pending answer and replaces its text, unless
+// text is empty. It reports false if there is no such pending answer, so an
+// answer is approved at most once.
+func (s *boltStore) Moderate(token string, id string, status string, text string) (ModerationItem, bool, error) {
+	var item ModerationItem
+	found := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(moderationBucket).Bucket([]byte(token))
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		if err := json.Unmarshal(data, &item); err != nil {
+			return err
+		}
+		if item.Status != moderationPending {
+			return nil
+		}
+
+		found = true
+		item.Status = status
+		if text != "" {
+			item.Text = text
+		}
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(id), data)
+	})
+	return item, found, err
+}
+
+// SaveCursor records the slide userID is on in a self-paced survey.
+func (s *boltStore) SaveCursor(token string, userID string, slide int) error {
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(cursorsBucket).CreateBucketIfNotExists([]byte(token))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(userID), []byte(strconv.Itoa(slide)))
+	})
+}
+
+// Cursors returns the slide every participant of a self-paced survey is on.
+func (s *boltStore) Cursors(token string) (map[string]int, error) {
+	cursors := make(map[string]int)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(cursorsBucket).Bucket([]byte(token))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			slide, err := strconv.Atoi(string(v))
+			if err != nil {
+				return err
+			}
+			cursors[string(k)] = slide
+			return nil
+		})
+	})
+	return cursors, err
+}
+
+// SigningKey returns the key cookies are signed with. It is generated on first
+// use.
+func (s *boltStore) SigningKey() ([]byte, error) {
+	var key []byte
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		state := tx.Bucket(stateBucket)
+		if stored := state.Get(signingKeyKey); stored != nil {
+			key = append([]byte(nil), stored...)
+			return nil
+		}
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		return state.Put(signingKeyKey, key)
+	})
+	return key, err
+}
+
+func (s *boltStore) SavePresenterLogin(id string, login PresenterLogin) error {
+	data, err := json.Marshal(login)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(loginsBucket).Put([]byte(id), data)
+	})
+}
+
+func (s *boltStore) PresenterLogin(id string) (PresenterLogin, bool, error) {
+	var login PresenterLogin
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(loginsBucket).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &login)
+	})
+	return login, found, err
+}
+
+func (s *boltStore) DeletePresenterLogin(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(loginsBucket).Delete([]byte(id))
+	})
+}
+
+// DeletePresenterLogins revokes every presenter login to token, and drops
+// expired logins of any survey while it is at it.
+func (s *boltStore) DeletePresenterLogins(token string) error {
+	now := time.Now()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(loginsBucket)
+		var stale [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var login PresenterLogin
+			if err := json.Unmarshal(v, &login); err != nil {
+				return err
+			}
+			if login.Token == token || now.After(login.Expires) {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Buckets with a nested bucket per token
+var tokenBuckets = [][]byte{scoresBucket, nicknamesBucket, questionsBucket, upvotesBucket, moderationBucket, cursorsBucket, participantsBucket, invitesBucket}
+
+// SaveParticipant records that userID joined the survey of token.
+func (s *boltStore) SaveParticipant(token string, userID string) error {
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(participantsBucket).CreateBucketIfNotExists([]byte(token))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(userID), []byte{})
+	})
+}
+
+func (s *boltStore) Participants(token string) ([]string, error) {
+	var userIDs []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(participantsBucket).Bucket([]byte(token))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, _ []byte) error {
+			userIDs = append(userIDs, string(k))
+			return nil
+		})
+	})
+	return userIDs, err
+}
+
+// SaveInvite records that code was used and takes part as userID.
+func (s *boltStore) SaveInvite(token string, code string, userID string) error {
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(invitesBucket).CreateBucketIfNotExists([]byte(token))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(code), []byte(userID))
+	})
+}
+
+// Invites returns the participant of every used invite code.
+func (s *boltStore) Invites(token string) (map[string]string, error) {
+	invites := make(map[string]string)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(invitesBucket).Bucket([]byte(token))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			invites[string(k)] = string(v)
+			return nil
+		})
+	})
+	return invites, err
+}
+
+// RenameToken moves everything stored for oldToken to newToken, and
+// remembers oldToken as retired. The config itself is saved by the caller.
+func (s *boltStore) RenameToken(oldToken string, newToken string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		state := tx.Bucket(stateBucket)
+		if err := state.Delete(configKey(oldToken)); err != nil {
+			return err
+		}
+		if err := moveKey(state, currentSlideKey(oldToken), currentSlideKey(newToken)); err != nil {
+			return err
+		}
+		if err := movePrefix(state, lockedPrefix(oldToken), lockedPrefix(newToken)); err != nil {
+			return err
+		}
+		if err := movePrefix(tx.Bucket(answersBucket), []byte(oldToken+":"), []byte(newToken+":")); err != nil {
+			return err
+		}
+		for _, name := range tokenBuckets {
+			if err := moveBucket(tx.Bucket(name), []byte(oldToken), []byte(newToken)); err != nil {
+				return err
+			}
+		}
+
+		// Presenters stay signed in
+		logins := tx.Bucket(loginsBucket)
+		updated := make(map[string][]byte)
+		err := logins.ForEach(func(k, v []byte) error {
+			var login PresenterLogin
+			if err := json.Unmarshal(v, &login); err != nil {
+				return err
+			}
+			if login.Token != oldToken {
+				return nil
+			}
+			login.Token = newToken
+			data, err := json.Marshal(login)
+			updated[string(k)] = data
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for k, data := range updated {
+			if err := logins.Put([]byte(k), data); err != nil {
+				return err
+			}
+		}
+
+		// Tokens retired earlier lead to the new token as well
+		retired := [][]byte{retiredKey(oldToken)}
+		c := state.Cursor()
+		for k, v := c.Seek(retiredPrefix); k != nil && bytes.HasPrefix(k, retiredPrefix); k, v = c.Next() {
+			if string(v) == oldToken {
+				retired = append(retired, append([]byte(nil), k...))
+			}
+		}
+		for _, k := range retired {
+			if err := state.Put(k, []byte(newToken)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func retiredKey(token string) []byte {
+	return append(append([]byte(nil), retiredPrefix...), token...)
+}
+
+// RetiredTokens returns every rotated out token and the token it led to.
+func (s *boltStore) RetiredTokens() (map[string]string, error) {
+	retired := make(map[string]string)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(stateBucket).Cursor()
+		for k, v := c.Seek(retiredPrefix); k != nil && bytes.HasPrefix(k, retiredPrefix); k, v = c.Next() {
+			retired[string(k[len(retiredPrefix):])] = string(v)
+		}
+		return nil
+	})
+	return retired, err
+}
+
+// moveKey renames the key from to to in b, if it exists.
+func moveKey(b *bolt.Bucket, from []byte, to []byte) error {
+	v := b.Get(from)
+	if v == nil {
+		return nil
+	}
+	if err := b.Put(to, append([]byte(nil), v...)); err != nil {
+		return err
+	}
+	return b.Delete(from)
+}
+
+// moveBucket renames the nested bucket from to to in parent, if it exists.
+func moveBucket(parent *bolt.Bucket, from []byte, to []byte) error {
+	src := parent.Bucket(from)
+	if src == nil {
+		return nil
+	}
+	dst, err := parent.CreateBucketIfNotExists(to)
+	if err != nil {
+		return err
+	}
+	if err := src.ForEach(func(k, v []byte) error {
+		return dst.Put(k, v)
+	}); err != nil {
+		return err
+	}
+	return parent.DeleteBucket(from)
+}
+
+// movePrefix replaces the prefix from with to in the names of the keys and
+// nested buckets of b.
+func movePrefix(b *bolt.Bucket, from []byte, to []byte) error {
+	var names [][]byte
+	c := b.Cursor()
+	for k, _ := c.Seek(from); k != nil && bytes.HasPrefix(k, from); k, _ = c.Next() {
+		names = append(names, append([]byte(nil), k...))
+	}
+
+	for _, name := range names {
+		renamed := append(append([]byte(nil), to...), name[len(from):]...)
+		var err error
+		if b.Bucket(name) != nil {
+			err = moveBucket(b, name, renamed)
+		} else {
+			err = moveKey(b, name, renamed)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset removes every answer, score, nickname, question, moderated answer,
+// participant, lock and the slide pointer stored for token.
+func (s *boltStore) Reset(token string) error {
+	prefix := []byte(token + ":")
+	return s.db.Update(func(tx *bolt.Tx) error {
+		state := tx.Bucket(stateBucket)
+		if err := state.Delete(currentSlideKey(token)); err != nil {
+			return err
+		}
+		if err := deletePrefix(state, lockedPrefix(token)); err != nil {
+			return err
+		}
+		for _, name := range tokenBuckets {
+			if tx.Bucket(name).Bucket([]byte(token)) == nil {
+				continue
+			}
+			if err := tx.Bucket(name).DeleteBucket([]byte(token)); err != nil {
+				return err
+			}
+		}
+
+		answers := tx.Bucket(answersBucket)
+		var stale [][]byte
+		c := answers.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			stale = append(stale, append([]byte(nil), k...))
+		}
+		for _, k := range stale {
+			if err := answers.DeleteBucket(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// deletePrefix removes every key in b that starts with prefix.
+func deletePrefix(b *bolt.Bucket, prefix []byte) error {
+	var stale [][]byte
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		stale = append(stale, append([]byte(nil), k...))
+	}
+	for _, k := range stale {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// slideTimer counts down the time limit of the active slide. The server owns
+// the deadline, so every client, including late joiners, sees the same
+// remaining time.
+type slideTimer struct {
+	mu       sync.Mutex
+	slide    int
+	deadline time.Time
+	stop     chan struct{}
+}
+
+// remaining returns the seconds left on the countdown for slide, or false
+// when slide has no running countdown.
+func (t *slideTimer) remaining(slide int) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stop == nil || t.slide != slide {
+		return 0, false
+	}
+	return secondsUntil(t.deadline), true
+}
+
+// cancel stops the running countdown. The caller must hold t.mu.
+func (t *slideTimer) cancel() {
+	if t.stop != nil {
+		close(t.stop)
+		t.stop = nil
+	}
+}
+
+// stopTimer stops the countdown without running its timeout action.
+func (s *Session) stopTimer() {
+	s.timer.mu.Lock()
+	defer s.timer.mu.Unlock()
+	s.timer.cancel()
+}
+
+func secondsUntil(deadline time.Time) int {
+	return int(time.Until(deadline).Round(time.Second) / time.Second)
+}
+
+// startTimer replaces any running countdown with one for slide, if the slide
+// has a time limit and voting on it is still open.
+func (s *Session) startTimer(slide int) {
+	t := &s.timer
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cancel()
+
+	survey := s.config().Survey
+	if slide < 0 || slide >= len(survey) || survey[slide].TimeLimit <= 0 || s.votingLocked(slide) {
+		return
+	}
+
+	t.slide = slide
+	t.deadline = time.Now().Add(survey[slide].TimeLimit)
+	t.stop = make(chan struct{})
+	go s.countdown(slide, t.deadline, t.stop)
+}
+
+// countdown broadcasts the remaining time every second and runs the timeout
+// action of the slide when the deadline passes.
+func (s *Session) countdown(slide int, deadline time.Time, stop chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	s.hub.broadcast <- Message{Type: "timer", Payload: secondsUntil(deadline)}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			remaining := secondsUntil(deadline)
+			s.hub.broadcast <- Message{Type: "timer", Payload: max(remaining, 0)}
+			if remaining > 0 {
+				continue
+			}
+
+			s.timer.mu.Lock()
+			stopped := s.timer.stop != stop
+			if !stopped {
+				s.timer.stop = nil
+			}
+			s.timer.mu.Unlock()
+			if !stopped {
+				s.runSlideAction(slide, s.config().Survey[slide].OnTimeout)
+			}
+			return
+		}
+	}
+}
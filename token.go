@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// join records that userID opened the survey, so the participant can follow
+// it to a new token.
+func (s *Session) join(userID string) {
+	if _, joined := s.joined.LoadOrStore(userID, true); joined {
+		return
+	}
+	if err := store.SaveParticipant(s.config().Token, userID); err != nil {
+		log.Printf("Error saving participant: %v", err)
+	}
+}
+
+func (s *Session) hasJoined(userID string) bool {
+	_, joined := s.joined.Load(userID)
+	return joined
+}
+
+// restoreParticipants reloads who joined the survey from the store.
+func (s *Session) restoreParticipants() {
+	userIDs, err := store.Participants(s.config().Token)
+	if err != nil {
+		log.Printf("Error loading participants: %v", err)
+	}
+	for _, userID := range userIDs {
+		s.joined.Store(userID, true)
+	}
+}
+
+// restoreRetiredTokens lets the rotated out tokens of every session lead to
+// the session again.
+func restoreRetiredTokens() {
+	retired, err := store.RetiredTokens()
+	if err != nil {
+		log.Printf("Error loading retired tokens: %v", err)
+		return
+	}
+	for oldToken, token := range retired {
+		if session, ok := sessions.get(token); ok {
+			sessions.retire(session, oldToken)
+		}
+	}
+}
+
+// rotateToken gives the session a new participant token. The old join link
+// stops working, while participants who already joined are sent on to the
+// new token.
+func (s *Session) rotateToken(token string) error {
+	oldToken := s.config().Token
+	if err := store.RenameToken(oldToken, token); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.cfg.Token = token
+	s.mu.Unlock()
+	if err := store.SaveConfig(s.config()); err != nil {
+		log.Printf("Error saving config: %v", err)
+	}
+
+	sessions.retire(s, oldToken)
+	s.hub.broadcast <- Message{Type: "tokenChanged", Payload: token}
+	return nil
+}
+
+// rotatedSession returns the session a rotated out token in a request led
+// to, as long as the participant making it joined the session before.
+func rotatedSession(c echo.Context, token string) (*Session, bool) {
+	session, ok := sessions.byRetiredToken(token)
+	if !ok {
+		return nil, false
+	}
+	userID, ok := participantID(c)
+	if !ok || !session.hasJoined(userID) {
+		return nil, false
+	}
+	return session, true
+}
+
+// followRotatedToken redirects participants who joined before the token of
+// their survey was rotated to the same page under the new token. Everyone
+// else gets "Invalid token" for the old one.
+func followRotatedToken(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token := c.Param("token")
+		if token == "" {
+			return next(c)
+		}
+		if _, ok := sessions.get(token); ok {
+			return next(c)
+		}
+		session, ok := rotatedSession(c, token)
+		if !ok {
+			return next(c)
+		}
+
+		// The token is the second segment of every participant route
+		segments := strings.Split(c.Request().URL.Path, "/")
+		if len(segments) < 3 || segments[2] != token {
+			return next(c)
+		}
+		segments[2] = session.config().Token
+		target := strings.Join(segments, "/")
+		if c.Request().Method == http.MethodGet {
+			return c.Redirect(http.StatusSeeOther, target)
+		}
+		// Answers are sent on to the new token as they are
+		return c.Redirect(http.StatusTemporaryRedirect, target)
+	}
+}
+
+// Tokens are path segments of the participant routes, and ":" separates
+// them from the rest of the keys in the store
+const tokenReservedChars = "/?#:"
+
+// validToken reports whether token can be used as a participant token.
+func validToken(token string) bool {
+	return token != "" && !strings.ContainsAny(token, tokenReservedChars)
+}
+
+// newToken returns a random participant token that is easy to type.
+func newToken() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strings.ToLower(base32.StdEncoding.EncodeToString(b)), nil
+}
+
+// handleRotateToken replaces the participant token of the survey with the
+// "token" form value, or a random one.
+func handleRotateToken(c echo.Context) error {
+	session := controlledSession(c)
+
+	token := strings.TrimSpace(c.FormValue("token"))
+	if token == "" {
+		var err error
+		if token, err = newToken(); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate a token"})
+		}
+	}
+	if !validToken(token) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid token"})
+	}
+	if sessions.inUse(token) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Token is already in use"})
+	}
+
+	if err := session.rotateToken(token); err != nil {
+		log.Printf("Error rotating token: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to rotate token"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"token": token})
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Text answers are cut off at this length unless the slide sets MaxLength
+const defaultMaxTextLength = 500
+
+// isRequired reports whether the slide must be answered. Slides are required
+// unless they set "required: false".
+func (slide Slide) isRequired() bool {
+	return slide.Required == nil || *slide.Required
+}
+
+func (slide Slide) maxTextLength() int {
+	if slide.MaxLength > 0 {
+		return slide.MaxLength
+	}
+	return defaultMaxTextLength
+}
+
+// readAnswers reads the submission for the slide from form and checks it
+// against the validation rules of the slide. The error is shown to the
+// participant.
+func (slide Slide) readAnswers(form url.Values) ([]string, error) {
+	if !slide.hasAnswer(form) {
+		if slide.isRequired() {
+			return nil, errors.New("Please answer the question")
+		}
+		return []string{}, nil
+	}
+
+	answer := form.Get("answer")
+	switch {
+	case slide.Type == "multiple":
+		if err := slide.validateSelections(form["answers"]); err != nil {
+			return nil, err
+		}
+		return slide.readOther(form["answers"], form.Get("other"))
+	case slide.Type == rankingSlideType:
+		return form["answers"], slide.validateRanking(form["answers"])
+	case slide.Type == matrixSlideType:
+		return slide.matrixAnswers(form)
+	case slide.isNumeric():
+		answer, err := slide.parseScaleValue(strings.TrimSpace(answer))
+		return []string{answer}, err
+	case slide.Type == "text":
+		return []string{answer}, slide.validateText(answer)
+	default:
+		if err := slide.validateChoice(answer); err != nil {
+			return nil, err
+		}
+		return slide.readOther([]string{answer}, form.Get("other"))
+	}
+}
+
+// hasAnswer reports whether form holds anything for the slide.
+func (slide Slide) hasAnswer(form url.Values) bool {
+	switch slide.Type {
+	case "multiple", rankingSlideType:
+		for _, answer := range form["answers"] {
+			if answer != "" {
+				return true
+			}
+		}
+	case matrixSlideType:
+		for i := range slide.Rows {
+			if form.Get(fmt.Sprintf("row-%d", i)) != "" {
+				return true
+			}
+		}
+	default:
+		return strings.TrimSpace(form.Get("answer")) != ""
+	}
+	return false
+}
+
+// validateRules rejects validation rules that no answer could pass or that
+// cannot be checked, before the survey runs.
+func (slide Slide) validateRules() error {
+	if slide.MinSelections < 0 || slide.MaxSelections < 0 || slide.MinLength < 0 || slide.MaxLength < 0 || slide.MaxWords < 0 {
+		return errors.New("minSelections, maxSelections, minLength, maxLength and maxWords must not be negative")
+	}
+	if slide.MaxSelections > 0 && slide.MinSelections > slide.MaxSelections {
+		return fmt.Errorf("minSelections %d is more than maxSelections %d", slide.MinSelections, slide.MaxSelections)
+	}
+	if slide.Type == "multiple" {
+		options := len(slide.Answers)
+		if slide.hasOther() {
+			options++
+		}
+		if slide.MinSelections > options {
+			return fmt.Errorf("minSelections %d is more than the %d answers to pick from", slide.MinSelections, options)
+		}
+	}
+	if slide.MinLength > slide.maxTextLength() {
+		return fmt.Errorf("minLength %d is more than maxLength %d", slide.MinLength, slide.maxTextLength())
+	}
+	if slide.Pattern != "" {
+		// Compiled on its own, so the error refers to the pattern as written
+		if _, err := regexp.Compile(slide.Pattern); err != nil {
+			return fmt.Errorf("pattern %q is not a valid regular expression: %v", slide.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// pattern compiles the Pattern of the slide to match whole answers.
+func (slide Slide) pattern() (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + slide.Pattern + ")$")
+}
+
+// validateChoice checks that answer is one of the options of the slide.
+func (slide Slide) validateChoice(answer string) error {
+	if slide.hasOther() && answer == otherOption {
+		return nil
+	}
+	for _, a := range slide.Answers {
+		if answer == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not an option", answer)
+}
+
+// validateSelections checks that every selection is a different option and
+// that the number of selections is within the limits of the slide.
+func (slide Slide) validateSelections(answers []string) error {
+	seen := make(map[string]bool)
+	for _, answer := range answers {
+		if seen[answer] {
+			return fmt.Errorf("%q is selected more than once", answer)
+		}
+		seen[answer] = true
+		if err := slide.validateChoice(answer); err != nil {
+			return err
+		}
+	}
+
+	if slide.MinSelections > 0 && len(answers) < slide.MinSelections {
+		return fmt.Errorf("Select at least %d answers", slide.MinSelections)
+	}
+	if slide.MaxSelections > 0 && len(answers) > slide.MaxSelections {
+		return fmt.Errorf("Select at most %d answers", slide.MaxSelections)
+	}
+	return nil
+}
+
+// validateText checks the length, word count and pattern of a text answer.
+func (slide Slide) validateText(answer string) error {
+	length := utf8.RuneCountInString(strings.TrimSpace(answer))
+	if slide.MinLength > 0 && length < slide.MinLength {
+		return fmt.Errorf("Answer must be at least %d characters", slide.MinLength)
+	}
+	if length > slide.maxTextLength() {
+		return fmt.Errorf("Answer must be at most %d characters", slide.maxTextLength())
+	}
+	if slide.MaxWords > 0 && len(strings.Fields(answer)) > slide.MaxWords {
+		return fmt.Errorf("Answer must be at most %d words", slide.MaxWords)
+	}
+
+	if slide.Pattern != "" {
+		// Patterns are checked when the config is loaded, so this only
+		// fails for surveys stored before that
+		pattern, err := slide.pattern()
+		if err != nil {
+			log.Printf("Invalid pattern on slide %q: %v", slide.Question, err)
+			return errors.New("Answer is not in the expected format")
+		}
+		if !pattern.MatchString(strings.TrimSpace(answer)) {
+			if slide.PatternHint != "" {
+				return errors.New(slide.PatternHint)
+			}
+			return errors.New("Answer is not in the expected format")
+		}
+	}
+	return nil
+}
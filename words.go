@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/kljensen/snowball"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Languages that stop word lists and stemming can be picked for
+var stemmerLanguages = map[string]string{
+	"en": "english",
+	"no": "norwegian",
+}
+
+// Text answers are split into entries at these characters, so "Go, Rust"
+// counts once for "go" and once for "rust"
+const termSeparators = ",;.!?()[]{}\"\n"
+
+// normalizeWords applies Unicode normalisation and case folding to text and
+// returns its words without punctuation and symbols. Apostrophes and hyphens
+// inside a word are kept.
+func normalizeWords(text string) []string {
+	// A Caser must not be shared between goroutines
+	text = cases.Fold().String(norm.NFKC.String(text))
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\'' && r != '-'
+	})
+	normalized := words[:0]
+	for _, word := range words {
+		if word = strings.Trim(word, "'-"); word != "" {
+			normalized = append(normalized, word)
+		}
+	}
+	return normalized
+}
+
+func normalizePhrase(text string) string {
+	return strings.Join(normalizeWords(text), " ")
+}
+
+// validateWords rejects stop word lists and stemming languages that do not
+// exist, which would otherwise leave answers unfiltered.
+func (slide Slide) validateWords() error {
+	for _, list := range slide.StopWordLists {
+		if _, ok := builtinStopWords[list]; !ok {
+			return fmt.Errorf("stopWordLists has %q, which is not one of %s", list, knownLanguages())
+		}
+	}
+	if _, ok := stemmerLanguages[slide.Stem]; slide.Stem != "" && !ok {
+		return fmt.Errorf("stem is %q, which is not one of %s", slide.Stem, knownLanguages())
+	}
+	return nil
+}
+
+func knownLanguages() string {
+	languages := make([]string, 0, len(stemmerLanguages))
+	for language := range stemmerLanguages {
+		languages = append(languages, strconv.Quote(language))
+	}
+	sort.Strings(languages)
+	return strings.Join(languages, ", ")
+}
+
+// isStopWord reports whether the normalised word is dropped from answers to
+// the slide.
+func (slide Slide) isStopWord(word string) bool {
+	for _, list := range slide.StopWordLists {
+		if builtinStopWords[list][word] {
+			return true
+		}
+	}
+	for _, stopWord := range slide.StopWords {
+		if normalizePhrase(stopWord) == word {
+			return true
+		}
+	}
+	return false
+}
+
+// synonym returns the entry that the normalised phrase is merged into.
+func (slide Slide) synonym(phrase string) (string, bool) {
+	for from, to := range slide.Synonyms {
+		if normalizePhrase(from) == phrase {
+			return normalizePhrase(to), true
+		}
+	}
+	return "", false
+}
+
+func (slide Slide) stem(word string) string {
+	language, ok := stemmerLanguages[slide.Stem]
+	if !ok {
+		return word
+	}
+	stemmed, err := snowball.Stem(word, language, false)
+	if err != nil {
+		return word
+	}
+	return stemmed
+}
+
+// textTerm is one entry of a text answer. Key is what is counted, Form is how
+// the entry reads before stemming.
+type textTerm struct {
+	Key  string
+	Form string
+}
+
+// textTerms runs an answer to a text slide through the word pipeline:
+// normalisation, synonyms, stop words and stemming. Every entry is returned
+// once, even if the answer repeats it.
+func (slide Slide) textTerms(answer string) []textTerm {
+	var terms []textTerm
+	seen := make(map[string]bool)
+	for _, part := range strings.FieldsFunc(answer, func(r rune) bool {
+		return strings.ContainsRune(termSeparators, r)
+	}) {
+		phrase := normalizePhrase(part)
+		if to, ok := slide.synonym(phrase); ok {
+			phrase = to
+		}
+
+		var forms, keys []string
+		for _, word := range strings.Fields(phrase) {
+			if to, ok := slide.synonym(word); ok {
+				word = to
+			}
+			if word == "" || slide.isStopWord(word) {
+				continue
+			}
+			forms = append(forms, word)
+			keys = append(keys, slide.stem(word))
+		}
+		if len(keys) == 0 {
+			continue
+		}
+
+		term := textTerm{Key: strings.Join(keys, " "), Form: strings.Join(forms, " ")}
+		if !seen[term.Key] {
+			seen[term.Key] = true
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// countedTerms returns the entries counted for the answers to a text slide.
+// Stemmed entries are shown as the first word form seen for the stem, so the
+// word cloud reads "running" rather than "run".
+func (s *Session) countedTerms(slide int, answers []string) []string {
+	config := s.config()
+	var counted []string
+	for _, answer := range answers {
+		for _, term := range config.Survey[slide].textTerms(answer) {
+			form, _ := s.wordForms.LoadOrStore(fmt.Sprintf("%d:%s", slide, term.Key), term.Form)
+			counted = append(counted, form.(string))
+		}
+	}
+	return counted
+}